@@ -0,0 +1,60 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// compatibility-matrix validates the compatibility matrix and exports it as JSON for Cypress
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/matrix"
+)
+
+func main() {
+	in := flag.String("matrix", "assets/compatibility-matrix.yaml", "compatibility matrix file")
+	out := flag.String("out", "cypress/latest/fixtures/compatibility-matrix.json", "JSON export for Cypress")
+	check := flag.Bool("check", false, "only check the JSON export is up to date")
+	flag.Parse()
+
+	if err := run(*in, *out, *check); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out string, check bool) error {
+	m, err := matrix.Load(in)
+	if err != nil {
+		return err
+	}
+	data, err := m.JSON()
+	if err != nil {
+		return err
+	}
+
+	if check {
+		current, err := os.ReadFile(out)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, data) {
+			return fmt.Errorf("%s is out of date, run `make compatibility-matrix`", out)
+		}
+		return nil
+	}
+	return os.WriteFile(out, data, 0644)
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/chartserver"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/precheck"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/proxy"
+)
+
+func runCollectLogs(args []string) error {
+	fs := newFlagSet("collect-logs")
+	dir := fs.String("dir", "logs", "directory where to write the logs")
+	script := fs.String("script", os.Getenv("RANCHER_LOG_COLLECTOR"), "log collector script run in the logs directory (RANCHER_LOG_COLLECTOR)")
+	kubeconfig := fs.String("kubeconfig", envString("KUBECONFIG", install.K3sKubeconfig), "kubeconfig of the cluster (KUBECONFIG)")
+	_ = fs.Parse(args)
+
+	if err := os.Setenv("KUBECONFIG", *kubeconfig); err != nil {
+		return err
+	}
+	err := install.CollectLogs(*dir, *script)
+	log.Printf("Logs written to %s", *dir)
+	return err
+}
+
+func runTeardown(args []string) error {
+	fs := newFlagSet("teardown")
+	k3s := fs.Bool("k3s", true, "uninstall K3s")
+	registry := fs.Bool("airgap-registry", true, "remove the airgap registry container")
+	egress := fs.Bool("egress", true, "remove the airgap egress block")
+	stateFile := fs.String("state-file", envString("INSTALL_STATE_FILE", install.DefaultStateFile), "install progress removed with K3s (INSTALL_STATE_FILE)")
+	_ = fs.Parse(args)
+
+	var errs []error
+	if *egress {
+		log.Printf("Removing the %s iptables chain", install.AirgapEgressChain)
+		install.UnblockEgress()
+	}
+	if *registry {
+		log.Printf("Removing the %s container", install.AirgapRegistryContainer)
+		errs = append(errs, install.RemoveRegistry())
+	}
+	if *k3s {
+		log.Printf("Uninstalling K3s")
+		errs = append(errs, install.UninstallK3s())
+		// The next install starts over
+		if err := os.Remove(*stateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runChartServer(args []string) error {
+	fs := newFlagSet("chart-server")
+	port := fs.String("port", envString("CHART_SERVER_PORT", "8080"), "listening port (CHART_SERVER_PORT)")
+	gitRoot := fs.String("git-root", os.Getenv("CHART_SERVER_GIT_ROOT"), "directory of the git repositories served under /git, e.g. the system charts repo built by build-local-rancher-charts.sh (CHART_SERVER_GIT_ROOT)")
+	charts := fs.String("charts", envString("CHART_SERVER_CHARTS", "assets/rancher-turtles-*.tgz assets/providers/rancher-turtles-providers-*.tgz"), "space separated chart archive patterns to publish (CHART_SERVER_CHARTS)")
+	_ = fs.Parse(args)
+
+	server := chartserver.New(":"+*port, *gitRoot)
+	published, err := server.PublishGlob(strings.Fields(*charts)...)
+	if err != nil {
+		return err
+	}
+	if err := server.Start(); err != nil {
+		return err
+	}
+	log.Printf("Chart server listening on %s, published charts: %v", server.Host(), published)
+
+	// Serve until interrupted
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	return server.Stop()
+}
+
+func runProxy(args []string) error {
+	fs := newFlagSet("proxy")
+	port := fs.String("port", envString("PROXY_PORT", "3128"), "listening port (PROXY_PORT)")
+	reportFile := fs.String("report", os.Getenv("PROXY_REPORT_FILE"), "where to write the hosts contacted through the proxy, on exit (PROXY_REPORT_FILE)")
+	_ = fs.Parse(args)
+
+	server := proxy.New(":" + *port)
+	if err := server.Start(); err != nil {
+		return err
+	}
+	if ip, err := proxy.OutboundIP(); err == nil {
+		log.Printf("Proxy listening on %s", server.URL(ip))
+	}
+
+	// Serve until interrupted
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	var report bytes.Buffer
+	err := server.WriteReport(&report)
+	fmt.Print(report.String())
+	if *reportFile != "" {
+		err = errors.Join(err, os.WriteFile(*reportFile, report.Bytes(), 0o644))
+	}
+	return errors.Join(err, server.Stop())
+}
+
+// preflightFlags are the install mode flags of preflight, also run by install
+type preflightFlags struct {
+	mode install.PreflightMode
+}
+
+func (f *preflightFlags) register(fs *flag.FlagSet) {
+	providers := envString("TURTLES_PROVIDERS_ENABLED", "bootstrapKubeadm,controlplaneKubeadm,infrastructureDocker")
+	fs.BoolVar(&f.mode.CAPD, "capd", slices.Contains(strings.Split(providers, ","), "infrastructureDocker"), "CAPD clusters are created, docker and its kind network are needed (infrastructureDocker in TURTLES_PROVIDERS_ENABLED)")
+	fs.StringVar(&f.mode.ChartServerPort, "chart-server-port", os.Getenv("CHART_SERVER_PORT"), "port the chart server already listens on, if any (CHART_SERVER_PORT)")
+}
+
+/**
+ * Check the host provides what an install mode needs and print the results table
+ * @param mode Install mode
+ * @returns Error listing the number of unmet requirements
+ */
+func checkHost(mode install.PreflightMode) error {
+	p, err := install.NewPreflight(mode)
+	if err != nil {
+		return err
+	}
+	results := precheck.RunChecks(p.Checks(), 4)
+	if err := precheck.WriteTable(os.Stdout, results); err != nil {
+		return err
+	}
+	if failures := precheck.Failures(results); len(failures) > 0 {
+		return fmt.Errorf("%d host requirement(s) not met", len(failures))
+	}
+	return nil
+}
+
+func runPreflight(args []string) error {
+	fs := newFlagSet("preflight")
+	var f preflightFlags
+	f.register(fs)
+	fs.BoolVar(&f.mode.DevTurtlesChart, "turtles-dev-chart", envBool("TURTLES_DEV_CHART"), "the git server of the dev system charts already listens, on "+install.SystemChartsGitPort+" or the chart server port (TURTLES_DEV_CHART)")
+	fs.BoolVar(&f.mode.Airgap, "airgap", false, "check for the airgap install, with its registry and egress block")
+	fs.IntVar(&f.mode.ProxyPort, "proxy-port", 0, "check for the proxy install, with its proxy on this port")
+	_ = fs.Parse(args)
+
+	return checkHost(f.mode)
+}
@@ -0,0 +1,327 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/rancher"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/fetch"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+)
+
+// rancherOptions are the flags shared by install and upgrade
+type rancherOptions struct {
+	rancherVersion        string
+	hostname              string
+	turtlesDevChart       bool
+	controllerImage       string
+	systemDefaultRegistry string
+	systemChartsRepo      string
+	systemChartsBranch    string
+	systemChartOverrides  string
+	systemChartsGitPort   string
+	rancherPointVersion   string
+	turtlesChartVersion   string
+	tls                   install.RancherTLS
+	proxyURL              string
+	noProxy               string
+}
+
+func (o *rancherOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.rancherVersion, "rancher-version", os.Getenv("RANCHER_VERSION"), "Rancher channel and version, e.g. prime/2.14.1 or head/2.14 (RANCHER_VERSION)")
+	fs.StringVar(&o.hostname, "hostname", os.Getenv("PUBLIC_DNS"), "Rancher hostname (PUBLIC_DNS)")
+	fs.BoolVar(&o.turtlesDevChart, "turtles-dev-chart", envBool("TURTLES_DEV_CHART"), "install the dev Turtles system chart and image (TURTLES_DEV_CHART)")
+	fs.StringVar(&o.controllerImage, "controller-image", os.Getenv("CONTROLLER_IMG"), "dev Turtles image (CONTROLLER_IMG)")
+	fs.StringVar(&o.systemDefaultRegistry, "system-default-registry", os.Getenv("AIRGAP_REGISTRY"), "registry the dev Turtles image is pulled from (AIRGAP_REGISTRY)")
+	fs.StringVar(&o.systemChartsRepo, "system-charts-repo", os.Getenv("SYSTEM_CHARTS_REPO_URL"), "git repository of the system charts (SYSTEM_CHARTS_REPO_URL)")
+	fs.StringVar(&o.systemChartsBranch, "system-charts-branch", os.Getenv("SYSTEM_CHARTS_BRANCH"), "branch of the system charts repository (SYSTEM_CHARTS_BRANCH)")
+	fs.StringVar(&o.systemChartOverrides, "system-chart-overrides", os.Getenv("SYSTEM_CHART_OVERRIDES"), "chart=version,... system chart versions (SYSTEM_CHART_OVERRIDES)")
+	fs.StringVar(&o.systemChartsGitPort, "system-charts-git-port", install.DevSystemChartsGitPort(os.Getenv("CHART_SERVER_PORT"), os.Getenv("CHART_SERVER_GIT_ROOT")),
+		"port of the git server holding the dev system charts, CHART_SERVER_PORT when the chart server has a git root (CHART_SERVER_GIT_ROOT)")
+	fs.StringVar(&o.rancherPointVersion, "rancher-point-version", os.Getenv("RANCHER_POINT_VERSION"), "Rancher point version of the dev system charts branch (RANCHER_POINT_VERSION)")
+	fs.StringVar(&o.turtlesChartVersion, "turtles-chart-dev-version", envString("TURTLES_CHART_DEV_VERSION", install.TurtlesChartDevVersion), "version of the dev Turtles system chart (TURTLES_CHART_DEV_VERSION)")
+	fs.StringVar(&o.tls.Mode, "tls-mode", envString("RANCHER_TLS_MODE", install.TLSRancher), "Rancher certificate: rancher, private-ca or letsencrypt (RANCHER_TLS_MODE)")
+	fs.StringVar(&o.tls.LetsEncryptEmail, "letsencrypt-email", os.Getenv("RANCHER_TLS_LETSENCRYPT_EMAIL"), "Let's Encrypt account email (RANCHER_TLS_LETSENCRYPT_EMAIL)")
+	fs.StringVar(&o.tls.LetsEncryptEnvironment, "letsencrypt-environment", envString("RANCHER_TLS_LETSENCRYPT_ENVIRONMENT", "staging"), "Let's Encrypt environment, staging or production (RANCHER_TLS_LETSENCRYPT_ENVIRONMENT)")
+	o.tls.Fetch = fetch.New().Get
+	fs.StringVar(&o.proxyURL, "proxy", os.Getenv("PROXY_URL"), "HTTP(S) proxy of K3s, Rancher and the Turtles and CAPI controllers, e.g. the one of 'turtles-e2e proxy' (PROXY_URL)")
+	fs.StringVar(&o.noProxy, "no-proxy", os.Getenv("PROXY_NO_PROXY"), "comma separated destinations reached without the proxy, added to the Rancher defaults (PROXY_NO_PROXY)")
+}
+
+// proxy returns the proxy configuration, nil without proxy
+func (o *rancherOptions) proxy() *install.ProxyConfig {
+	if o.proxyURL == "" {
+		return nil
+	}
+	config := install.NewProxyConfig(o.proxyURL, strings.FieldsFunc(o.noProxy, func(r rune) bool { return r == ',' })...)
+	return &config
+}
+
+func (o *rancherOptions) validate() error {
+	switch {
+	case o.rancherVersion == "":
+		return errors.New("--rancher-version (RANCHER_VERSION) must be set")
+	case o.hostname == "":
+		return errors.New("--hostname (PUBLIC_DNS) must be set")
+	case o.turtlesDevChart && o.controllerImage == "":
+		return errors.New("--controller-image (CONTROLLER_IMG) must be set with --turtles-dev-chart")
+	}
+	if err := o.tls.Validate(); err != nil {
+		return err
+	}
+	_, err := install.RancherVersionMatches(o.rancherVersion, ">=2.13")
+	return err
+}
+
+// systemCharts returns the system charts configuration, like the Ginkgo install spec
+func (o *rancherOptions) systemCharts() (install.SystemChartsConfig, error) {
+	config := install.SystemChartsConfig{RepoURL: o.systemChartsRepo, Branch: o.systemChartsBranch}
+	if o.turtlesDevChart {
+		config.UseDevTurtles(o.hostname, o.systemChartsGitPort, o.rancherPointVersion, o.turtlesChartVersion)
+	}
+	overrides, err := install.ParseSystemChartOverrides(o.systemChartOverrides)
+	if err != nil {
+		return config, err
+	}
+	for _, override := range overrides {
+		config.Set(override)
+	}
+	return config, nil
+}
+
+// stateSettings returns the settings an install depends on, like the Ginkgo install spec
+func (o *rancherOptions) stateSettings() install.StateSettings {
+	return install.StateSettings{
+		RancherVersion:        o.rancherVersion,
+		Hostname:              o.hostname,
+		TLSMode:               o.tls.Mode,
+		TurtlesDevChart:       o.turtlesDevChart,
+		ControllerImage:       o.controllerImage,
+		SystemDefaultRegistry: o.systemDefaultRegistry,
+		SystemChartOverrides:  o.systemChartOverrides,
+		ProxyURL:              o.proxyURL,
+	}
+}
+
+// logStep logs why a step of a resumed install was skipped or applied again
+func logStep(state *install.State, step string, applied bool) {
+	if outcome := state.Outcome(step, applied); outcome != "" {
+		log.Print(outcome)
+	}
+}
+
+/**
+ * Install or upgrade Rancher Manager and wait for it, like the Ginkgo install/upgrade spec
+ * @param o Rancher options
+ * @param state Install state, nil on upgrade to always deploy Rancher
+ * @returns Nothing, the error of the first failing step
+ */
+func deployRancher(o *rancherOptions, state *install.State) error {
+	withTurtles, err := install.RancherVersionMatches(o.rancherVersion, ">=2.13")
+	if err != nil {
+		return err
+	}
+
+	var extraFlags []string
+	expectedVersions := map[string]string{}
+	if withTurtles {
+		config, err := o.systemCharts()
+		if err != nil {
+			return err
+		}
+		for _, override := range config.Overrides {
+			expectedVersions[override.Chart] = override.Version
+		}
+		if len(config.Env()) > 0 {
+			log.Printf("System charts overrides: %+v", config.Env())
+			if extraFlags, err = config.HelmFlags(filepath.Join(os.TempDir(), "rancher-system-charts")); err != nil {
+				return err
+			}
+		}
+	}
+	proxy := o.proxy()
+	if proxy != nil {
+		extraFlags = append(extraFlags, proxy.RancherHelmFlags()...)
+	}
+	// TLS mode flags are needed on upgrade too, helm would reset them otherwise
+	tlsFlags, err := o.tls.Prepare(o.hostname)
+	if err != nil {
+		return err
+	}
+	extraFlags = append(extraFlags, tlsFlags...)
+	// Overrides ele-testhelpers default behavior, put it as last to ensure it takes precedence over existing flags.
+	extraFlags = append(extraFlags, "--set", "useBundledSystemChart=false")
+
+	channel, version, headVersion := install.ParseRancherVersion(o.rancherVersion)
+	found := func() (bool, error) { return install.RancherDeployed(o.rancherVersion) }
+	applied, err := state.Run(install.StepRancher, found, func() error {
+		log.Printf("Deploying Rancher Manager %s %s on %s", channel, version, o.hostname)
+		return rancher.DeployRancherManager(o.hostname, channel, version, headVersion, "none", "none", extraFlags)
+	})
+	if err != nil {
+		return err
+	}
+	logStep(state, install.StepRancher, applied)
+
+	if o.turtlesDevChart && withTurtles {
+		log.Printf("Patching rancher-config to use %s", o.controllerImage)
+		if _, err := install.PatchTurtlesConfig(o.controllerImage, o.systemDefaultRegistry); err != nil {
+			return err
+		}
+	}
+	if proxy != nil && withTurtles {
+		// Turtles downloads the provider manifests
+		log.Printf("Patching rancher-config to use the proxy %s", proxy.URL)
+		if _, err := proxy.PatchTurtlesConfig(); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Waiting for Rancher Manager resources")
+	deployments := []install.Deployment{{Namespace: "cattle-system", Name: "rancher-webhook"}}
+	if withTurtles {
+		deployments = append(deployments, install.TurtlesDeployments...)
+	}
+	if proxy != nil && withTurtles {
+		log.Printf("Waiting for the proxy of the Turtles controller")
+		if err := install.Retry(5*time.Minute, 10*time.Second, func() error {
+			return proxy.CheckDeploymentEnv("cattle-turtles-system", "rancher-turtles-controller-manager")
+		}); err != nil {
+			return err
+		}
+	}
+	if err := install.WaitForDeployments(deployments); err != nil {
+		return err
+	}
+	if proxy != nil && withTurtles {
+		log.Printf("Setting the proxy of the CAPI controllers")
+		if _, err := proxy.PatchCAPIProviders(); err != nil {
+			return err
+		}
+	}
+	for _, c := range install.RancherReadinessChecks(o.hostname, withTurtles, expectedVersions) {
+		log.Printf("Checking %s", c.Name)
+		// Let's Encrypt certificates take a while to be issued
+		if err := install.Retry(10*time.Minute, 10*time.Second, c.Run); err != nil {
+			return fmt.Errorf("checking %s: %w", c.Name, err)
+		}
+	}
+	log.Printf("Rancher Manager is available on https://%s", o.hostname)
+	return nil
+}
+
+func runInstall(args []string) error {
+	fs := newFlagSet("install")
+	var o rancherOptions
+	o.register(fs)
+	skipK3s := fs.Bool("skip-k3s", false, "use the cluster of KUBECONFIG instead of installing K3s")
+	skipCertManager := fs.Bool("skip-cert-manager", false, "do not install cert-manager")
+	skipPreflight := fs.Bool("skip-preflight", false, "do not check the host before installing K3s")
+	var preflight preflightFlags
+	preflight.register(fs)
+	stateFile := fs.String("state-file", envString("INSTALL_STATE_FILE", install.DefaultStateFile), "where the install progress is recorded, to resume an interrupted install with the same flags (INSTALL_STATE_FILE)")
+	_ = fs.Parse(args)
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	state, err := install.LoadState(*stateFile, o.stateSettings().Config())
+	if err != nil {
+		return err
+	}
+
+	if !*skipK3s && !*skipPreflight {
+		log.Printf("Checking the host")
+		preflight.mode.DevTurtlesChart = o.turtlesDevChart
+		if err := checkHost(preflight.mode); err != nil {
+			return err
+		}
+	}
+
+	if !*skipK3s {
+		found := func() (bool, error) { return install.K3sRunning(), nil }
+		applied, err := state.Run(install.StepK3s, found, func() error {
+			log.Printf("Installing K3s %s", install.K3sInstallerVersion)
+			installer := filepath.Join(os.TempDir(), install.K3sInstallerFile)
+			if err := install.DownloadK3sInstaller(installer); err != nil {
+				return err
+			}
+			var env []string
+			if proxy := o.proxy(); proxy != nil {
+				env = proxy.Env()
+			}
+			if out, err := install.RunK3sInstaller(installer, env...); err != nil {
+				return errors.Join(err, errors.New(string(out)))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		logStep(state, install.StepK3s, applied)
+		// Also sets KUBECONFIG when K3s is already running
+		if err := install.StartK3s(); err != nil {
+			return err
+		}
+		if err := install.WaitForDeployments(install.K3sDeployments); err != nil {
+			return err
+		}
+	}
+
+	if !*skipCertManager {
+		applied, err := state.Run(install.StepCertManager, install.CertManagerDeployed, func() error {
+			log.Printf("Installing cert-manager")
+			if out, err := install.InstallCertManager(install.CertManagerChart); err != nil {
+				return errors.Join(err, errors.New(out))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		logStep(state, install.StepCertManager, applied)
+		if err := install.WaitForDeployments([]install.Deployment{{Namespace: "cert-manager", Name: "cert-manager"}}); err != nil {
+			return err
+		}
+	}
+
+	return deployRancher(&o, state)
+}
+
+func runUpgrade(args []string) error {
+	fs := newFlagSet("upgrade")
+	var o rancherOptions
+	o.register(fs)
+	_ = fs.Parse(args)
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	// K3s kubeconfig, unless another cluster is selected
+	if os.Getenv("KUBECONFIG") == "" {
+		if err := os.Setenv("KUBECONFIG", install.K3sKubeconfig); err != nil {
+			return err
+		}
+	}
+	return deployRancher(&o, nil)
+}
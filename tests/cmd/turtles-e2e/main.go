@@ -0,0 +1,112 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// turtles-e2e runs the install, upgrade, precheck, log collection and teardown steps of the e2e
+// tests without Ginkgo. Flags default to the environment variables read by the Ginkgo suite.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// command is a turtles-e2e subcommand
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+// commands are set in init, as their flag sets refer to them for the usage
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"install":      {"Install K3s, cert-manager and Rancher Manager on this host", runInstall},
+		"upgrade":      {"Upgrade Rancher Manager", runUpgrade},
+		"preflight":    {"Check this host provides what an install mode needs", runPreflight},
+		"precheck":     {"Check the artifacts needed for an airgapped install are published", runPrecheck},
+		"collect-logs": {"Collect the state and logs of Rancher, Turtles and CAPI", runCollectLogs},
+		"teardown":     {"Remove K3s, the airgap registry and the egress block from this host", runTeardown},
+		"chart-server": {"Serve the Turtles charts as a Helm repository, an OCI registry and git repositories, until interrupted", runChartServer},
+		"proxy":        {"Run a forward HTTP(S) proxy and report the hosts contacted through it", runProxy},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: turtles-e2e <command> [flags]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'turtles-e2e <command> -h' for the flags of a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, found := commands[os.Args[1]]
+	if !found {
+		if os.Args[1] != "-h" && os.Args[1] != "--help" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		}
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet creates the flag set of a subcommand
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("turtles-e2e "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: turtles-e2e %s [flags]\n\n%s\n\nFlags:\n", name, commands[name].summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// envString returns an environment variable, or def when unset
+func envString(name, def string) string {
+	if v, found := os.LookupEnv(name); found && v != "" {
+		return v
+	}
+	return def
+}
+
+// envBool returns a boolean environment variable, false when unset or invalid
+func envBool(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
+
+// envInt returns an integer environment variable, or def when unset or invalid
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return v
+	}
+	return def
+}
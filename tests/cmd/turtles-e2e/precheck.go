@@ -0,0 +1,101 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/fetch"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/matrix"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/precheck"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/registryauth"
+)
+
+func runPrecheck(args []string) error {
+	fs := newFlagSet("precheck")
+	rancherVersion := fs.String("rancher-version", os.Getenv("RANCHER_VERSION"), "released Rancher channel and version, e.g. prime/2.14.1 or latest/2.14.2 (RANCHER_VERSION)")
+	registries := precheck.Registries{}
+	fs.StringVar(&registries.Prime, "prime-registry", os.Getenv("PRIME_REGISTRY"), "Prime registry (PRIME_REGISTRY)")
+	fs.StringVar(&registries.StgPrime, "stg-prime-registry", os.Getenv("STG_PRIME_REGISTRY"), "Prime staging registry of rc and alpha builds (STG_PRIME_REGISTRY)")
+	fs.StringVar(&registries.Community, "community-registry", envString("COMMUNITY_REGISTRY", "docker.io"), "community registry (COMMUNITY_REGISTRY)")
+	artifactsURL := fs.String("prime-artifacts-url", os.Getenv("PRIME_ARTIFACTS_URL"), "Prime artifacts URL, holding rancher-images.txt (PRIME_ARTIFACTS_URL)")
+	matrixFile := fs.String("matrix", envString("COMPATIBILITY_MATRIX", "assets/compatibility-matrix.yaml"), "compatibility matrix file, empty not to check the Kubernetes versions (COMPATIBILITY_MATRIX)")
+	workers := fs.Int("workers", envInt("PRECHECK_WORKERS", 8), "number of checks run in parallel (PRECHECK_WORKERS)")
+	cacheDir := fs.String("fetch-cache-dir", envString("FETCH_CACHE_DIR", filepath.Join(os.TempDir(), "turtles-e2e-fetch-cache")), "cache of the source documents (FETCH_CACHE_DIR)")
+	provenanceFile := fs.String("fetch-provenance-file", os.Getenv("FETCH_PROVENANCE_FILE"), "where to write the provenance of the source documents (FETCH_PROVENANCE_FILE)")
+	_ = fs.Parse(args)
+
+	channel, version, _ := install.ParseRancherVersion(*rancherVersion)
+	if version == "" || channel == "head" {
+		return errors.New("--rancher-version (RANCHER_VERSION) must be a released <channel>/<version>")
+	}
+	if ok, err := install.RancherVersionMatches(*rancherVersion, ">=2.13"); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("the precheck requires a released Rancher >= 2.13, not %s", *rancherVersion)
+	}
+
+	// Registry credentials and the GitHub token are only read from the environment, like the Ginkgo suite
+	auth, err := registryauth.FromEnv()
+	if err != nil {
+		return err
+	}
+	fetcher := fetch.New(fetch.WithCacheDir(*cacheDir), fetch.WithGitHubToken(os.Getenv("GITHUB_TOKEN")))
+
+	release, err := precheck.Resolve(fetcher.Get, version, !strings.Contains(channel, "prime"))
+	if err != nil {
+		return err
+	}
+	log.Printf("Turtles %s (chart %s), providers %v", release.TurtlesVersion, release.TurtlesChartVersion, release.Providers)
+
+	v := &precheck.Validation{
+		Release:      release,
+		Registries:   registries,
+		ArtifactsURL: *artifactsURL,
+		Fetch:        fetcher.Get,
+		Auth:         auth,
+	}
+	if *matrixFile != "" {
+		if v.Matrix, err = matrix.Load(*matrixFile); err != nil {
+			return err
+		}
+	}
+
+	checks, err := v.Checks()
+	if err != nil {
+		return err
+	}
+	log.Printf("Running %d checks with %d workers", len(checks), *workers)
+	results := precheck.RunChecks(checks, *workers)
+	if err := precheck.WriteTable(os.Stdout, results); err != nil {
+		return err
+	}
+
+	if *provenanceFile != "" {
+		if err := fetcher.WriteProvenance(*provenanceFile); err != nil {
+			return err
+		}
+	}
+	if failures := precheck.Failures(results); len(failures) > 0 {
+		return fmt.Errorf("%d check(s) failed", len(failures))
+	}
+	return nil
+}
@@ -1,9 +1,19 @@
+import semver from 'semver';
 import {
-  isAPIv1beta1,
   isRancherManagerVersion,
   isTurtlesDevChart, isUpgrade,
   providersChartNeedsStgRegistry
 } from './utils';
+// Generated from assets/compatibility-matrix.yaml with `make compatibility-matrix`
+import compatibilityMatrix from '../fixtures/compatibility-matrix.json';
+
+// Versions for the tested Rancher minor, the `default` entry covers the development branch
+const compatibility = (() => {
+  const rancherVersion = semver.coerce(Cypress.expose('rancher_version'));
+  const minor = rancherVersion ? `${rancherVersion.major}.${rancherVersion.minor}` : 'default';
+  const releases: Record<string, typeof compatibilityMatrix.releases.default> = compatibilityMatrix.releases;
+  return releases[minor] ?? releases.default;
+})()
 
 const primeRegistry = Cypress.expose('prime_registry');
 const stgPrimeRegistry = Cypress.expose('stg_prime_registry');
@@ -13,7 +23,7 @@ export const vars = {
   shortTimeout: 600000,
   fullTimeout: 1500000,
   rancherTurtlesE2EBranch: Cypress.expose('rancher_turtles_e2e_branch'),
-  classBranch: isRancherManagerVersion('2.12') ? 'release-0.24' : isRancherManagerVersion('2.13') ? 'release/v0.25' : isRancherManagerVersion('2.14') ? 'release/v0.26' : isRancherManagerVersion('2.15') ? 'release/v0.27' : 'main',
+  classBranch: compatibility.classBranch,
   noCaapfClassBranch: 'main', // use main branch for no-caapf tests
   capiClustersNS: 'capi-clusters',
   capiClassesNS: 'capi-classes',
@@ -31,12 +41,12 @@ export const vars = {
   turtlesProvidersHelmApp: 'rancher-turtles-providers',
   turtlesProvidersOCIRepo: `oci://${turtlesProvidersRegistry}/rancher/charts/rancher-turtles-providers`,
   turtlesProvidersChartName: 'rancher-turtles-providers',
-  eksVersion: isAPIv1beta1 ? 'v1.32.0' : 'v1.35.4',
-  aksVersion: isRancherManagerVersion('2.12') ? 'v1.33.4' : isRancherManagerVersion('2.13') ? 'v1.34.7' : 'v1.35.4',
-  kindVersion: isRancherManagerVersion('2.12') ? 'v1.33.4' : isRancherManagerVersion('2.13') ? 'v1.34.0' : isRancherManagerVersion('2.14') ? 'v1.35.0' : 'v1.36.1',
-  kubeadmVersion: isRancherManagerVersion('2.12') ? 'v1.33.4' : isRancherManagerVersion('2.13') ? 'v1.34.1' : isRancherManagerVersion('2.14') ? 'v1.35.0' : 'v1.36.1',
-  rke2Version: isRancherManagerVersion('2.12') ? 'v1.33.4+rke2r1' : isRancherManagerVersion('2.13') ? 'v1.34.1+rke2r1' : isRancherManagerVersion('2.14') ? 'v1.35.0+rke2r1' : 'v1.36.0+rke2r1',
-  v2provRKE2Version: isRancherManagerVersion('2.12') ? 'v1.33.4+rke2r1' : isRancherManagerVersion('2.13') ? 'v1.34.8+rke2r2' : 'v1.35.4+rke2r1',
+  eksVersion: compatibility.kubernetes.eks,
+  aksVersion: compatibility.kubernetes.aks,
+  kindVersion: compatibility.kubernetes.kind,
+  kubeadmVersion: compatibility.kubernetes.kubeadm,
+  rke2Version: compatibility.kubernetes.rke2,
+  v2provRKE2Version: compatibility.kubernetes.v2provRKE2,
   amiID: isRancherManagerVersion('2.12') ? 'ami-07cded2dd011bc687' // Private copy of ami-0cd9e4e7906f4c9dd from eu-west-2
   : isRancherManagerVersion('2.13') ? 'ami-010b4d392889007a3' // Private copy of ami-055123d49b91c2827 from eu-west-2
   : isRancherManagerVersion('2.14') ? 'ami-0da7e3e1c75ab13ab' // Private copy of ami-0bb0dc2c3c4dbf68f from eu-west-2
@@ -74,120 +84,6 @@ export const vars = {
   })()
 };
 
-type BuildType = 'prod-v2.12' | 'prod-v2.13' | 'prod-v2.14' | 'prod-v2.15' | 'dev-v2.12' | 'dev-v2.13' | 'dev-v2.14' | 'dev-v2.15';
-
-const buildType = ((): BuildType => {
-  if (isTurtlesDevChart && isRancherManagerVersion('2.12')){
-    return 'dev-v2.12';
-  }
-  if (isTurtlesDevChart && isRancherManagerVersion('2.13')) {
-    return 'dev-v2.13';
-  }
-  if (isTurtlesDevChart && isRancherManagerVersion('2.14')) {
-    return 'dev-v2.14';
-  }
-  if (isTurtlesDevChart && isRancherManagerVersion('2.15')) {
-    return 'dev-v2.15';
-  }
-  if(isRancherManagerVersion('2.12')){
-    return 'prod-v2.12';
-  }
-  if (isRancherManagerVersion('2.13')) {
-    return 'prod-v2.13';
-  }
-  if (isRancherManagerVersion('2.14')) {
-    return 'prod-v2.14';
-  }
-  if (isRancherManagerVersion('2.15')) {
-    return 'prod-v2.15';
-  }
-  // This should never happen
-  throw new Error('Unable to determine BuildType from Rancher Manager version and chart settings');
-})()
-
-const buildTypeVersionMap = {
-  'prod-v2.12': {
-    capi: 'v1.10.5',
-    rke2: 'v0.20.1',
-    kubeadm: 'v1.10.5',
-    fleet: 'v0.11.0',
-    vsphere: 'v1.13.1',
-    amazon: 'v2.9.1',
-    google: 'v1.10.0',
-    azure: 'v1.21.0'
-  },
-  'prod-v2.13': {
-    capi: 'v1.10.6',
-    rke2: 'v0.21.1',
-    kubeadm: 'v1.10.6',
-    fleet: 'v0.12.0',
-    vsphere: 'v1.13.1',
-    amazon: 'v2.9.1',
-    google: 'v1.10.0',
-    azure: 'v1.21.0'
-  },
-  'prod-v2.14': {
-    capi: 'v1.12.7',
-    rke2: 'v0.24.4',
-    kubeadm: 'v1.12.7',
-    fleet: 'v0.14.1',
-    vsphere: 'v1.15.2',
-    amazon: 'v2.11.1',
-    google: 'v1.11.1',
-    azure: 'v1.22.0'
-  },
-  'prod-v2.15': {
-    capi: 'v1.13.3',
-    rke2: 'v0.25.0',
-    kubeadm: 'v1.13.3',
-    fleet: 'v0.15.0',
-    vsphere: 'v1.16.1',
-    amazon: 'v2.11.1',
-    google: 'v1.13.1',
-    azure: 'v1.26.0'
-  },
-  'dev-v2.12': {
-    capi: 'v1.10.5',
-    rke2: 'v0.20.1',
-    kubeadm: 'v1.10.5',
-    fleet: 'v0.11.0',
-    vsphere: 'v1.13.1',
-    amazon: 'v2.9.1',
-    google: 'v1.10.0',
-    azure: 'v1.21.0'
-  },
-  'dev-v2.13': {
-    capi: 'v1.10.6',
-    rke2: 'v0.21.1',
-    kubeadm: 'v1.10.6',
-    fleet: 'v0.12.0',
-    vsphere: 'v1.13.1',
-    amazon: 'v2.9.1',
-    google: 'v1.10.0',
-    azure: 'v1.21.0'
-  },
-  'dev-v2.14': {
-    capi: 'v1.12.7',
-    rke2: 'v0.24.4',
-    kubeadm: 'v1.12.7',
-    fleet: 'v0.14.1',
-    vsphere: 'v1.15.2',
-    amazon: 'v2.11.1',
-    google: 'v1.11.1',
-    azure: 'v1.22.0'
-  },
-  'dev-v2.15': {
-    capi: 'v1.13.3',
-    rke2: 'v0.25.0',
-    kubeadm: 'v1.13.3',
-    fleet: 'v0.15.0',
-    vsphere: 'v1.16.1',
-    amazon: 'v2.11.1',
-    google: 'v1.13.1',
-    azure: 'v1.26.0'
-  }
-}
-
 export const providers = {
   coreCAPIProvider: 'cluster-api',
   rke2Provider: 'rke2',
@@ -198,12 +94,12 @@ export const providers = {
   azureProvider: 'azure',
   fleetProvider: 'fleet',
   vsphereProvider: 'vsphere',
-  coreCAPIProviderVersion: buildTypeVersionMap[buildType].capi,
-  rke2ProviderVersion: buildTypeVersionMap[buildType].rke2,
-  kubeadmProviderVersion: buildTypeVersionMap[buildType].kubeadm,
-  fleetProviderVersion: buildTypeVersionMap[buildType].fleet,
-  vsphereProviderVersion: buildTypeVersionMap[buildType].vsphere,
-  amazonProviderVersion: buildTypeVersionMap[buildType].amazon,
-  googleProviderVersion: buildTypeVersionMap[buildType].google,
-  azureProviderVersion: buildTypeVersionMap[buildType].azure
+  coreCAPIProviderVersion: compatibility.providers['cluster-api'],
+  rke2ProviderVersion: compatibility.providers.rke2,
+  kubeadmProviderVersion: compatibility.providers.kubeadm,
+  fleetProviderVersion: compatibility.providers['rancher-fleet'],
+  vsphereProviderVersion: compatibility.providers.vsphere,
+  amazonProviderVersion: compatibility.providers.aws,
+  googleProviderVersion: compatibility.providers.gcp,
+  azureProviderVersion: compatibility.providers.azure
 }
@@ -0,0 +1,97 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/precheck"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/registryauth"
+)
+
+// precheckDigest returns the digest of an image or component artifact of a release
+func precheckDigest(release *precheck.Release, image precheck.Image, component bool) (string, error) {
+	host := imageRegistry(release)
+	if component {
+		// Components are always stored on prime registry, even for rc/alpha releases
+		host = primeRegistry
+	}
+	ref := fmt.Sprintf("%s/%s", host, image)
+	digest, err := crane.Digest(ref, registryAuth.CraneOptions(host)...)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref, registryauth.Classify(err))
+	}
+	return digest, nil
+}
+
+var _ = Describe("E2E - Airgap Precheck Diff", Label("airgap-diff"), func() {
+	var baseChannel, baseVersion string
+
+	BeforeEach(func() {
+		base := os.Getenv("PRECHECK_BASE_RANCHER_VERSION")
+		Expect(base).To(ContainSubstring("/"), "PRECHECK_BASE_RANCHER_VERSION must be set as <channel>/<version>, e.g. prime/2.14.1")
+		var baseHeadVersion string
+		baseChannel, baseVersion, baseHeadVersion = install.ParseRancherVersion(base)
+		baseTooOld, err := install.RancherVersionMatches(base, "<2.13")
+		Expect(err).To(Not(HaveOccurred()))
+
+		// Like the precheck, only released Rancher >= 2.13 have a build.yaml tag to read, head and devel builds do not
+		if rancherChannel == "head" || rancherHeadVersion != "" || isRancherManagerVersion("<2.13") ||
+			baseChannel == "head" || baseHeadVersion != "" || baseTooOld {
+			Skip(fmt.Sprintf("Skipping airgap precheck diff: requires released Rancher >= 2.13 (base=%s, candidate=%s)", base, os.Getenv("RANCHER_VERSION")))
+		}
+	})
+
+	It("Compare the artifacts of two Rancher versions", func() {
+		var from, to *precheck.Release
+
+		By("Resolving the versions of both releases", func() {
+			var err error
+			from, err = precheck.Resolve(sourceFetcher.Get, baseVersion, !strings.Contains(baseChannel, "prime"))
+			Expect(err).To(Not(HaveOccurred()), "Unable to resolve base Rancher %s", baseVersion)
+			to, err = precheck.Resolve(sourceFetcher.Get, rancherVersion, isCommunityPrecheck())
+			Expect(err).To(Not(HaveOccurred()), "Unable to resolve candidate Rancher %s", rancherVersion)
+		})
+
+		By("Writing the diff as Markdown and JSON", func() {
+			diff := precheck.Compare(from, to, precheckDigest)
+			for _, e := range diff.DigestErrors {
+				GinkgoWriter.Printf("⚠️ Digest not compared: %s\n", e)
+			}
+
+			dir := os.Getenv("PRECHECK_DIFF_DIR")
+			if dir == "" {
+				dir = os.TempDir()
+			}
+			Expect(os.MkdirAll(dir, 0o755)).To(Succeed())
+
+			markdown := diff.Markdown()
+			data, err := diff.JSON()
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(os.WriteFile(filepath.Join(dir, "precheck-diff.md"), []byte(markdown), 0o644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "precheck-diff.json"), data, 0o644)).To(Succeed())
+
+			GinkgoWriter.Println(markdown)
+			GinkgoWriter.Printf("Diff written to %s\n", filepath.Join(dir, "precheck-diff.{md,json}"))
+		})
+	})
+})
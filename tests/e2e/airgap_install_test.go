@@ -0,0 +1,311 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/mirror"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/precheck"
+)
+
+const airgapCopyWorkers = 8
+
+// airgapArch returns the architecture of the images to mirror, the one of the host unless ARCH is set
+func airgapArch() string {
+	if arch != "" {
+		return arch
+	}
+	return runtime.GOARCH
+}
+
+// k3sAirgapArtifacts returns the URL of the K3s binary and airgap images by file name, see https://docs.k3s.io/installation/airgap
+func k3sAirgapArtifacts() map[string]string {
+	base := "https://github.com/k3s-io/k3s/releases/download/" + url.PathEscape(install.K3sInstallerVersion)
+	binary := "k3s"
+	if airgapArch() != "amd64" {
+		binary = "k3s-" + airgapArch()
+	}
+	return map[string]string{
+		"k3s": base + "/" + binary,
+		"k3s-airgap-images-" + airgapArch() + ".tar.zst": base + "/k3s-airgap-images-" + airgapArch() + ".tar.zst",
+	}
+}
+
+// rancherChartRepoURL returns the Helm repository of the Rancher chart for the channel
+func rancherChartRepoURL() string {
+	if repo := os.Getenv("AIRGAP_RANCHER_CHART_REPO"); repo != "" {
+		return repo
+	}
+	if strings.HasPrefix(rancherChannel, "prime") {
+		return "https://charts.rancher.com/server-charts/prime"
+	}
+	return "https://releases.rancher.com/server-charts/" + rancherChannel
+}
+
+/**
+ * Download a chart archive
+ * @param chart Name of the chart
+ * @param repo URL of the Helm repository
+ * @param version Version of the chart, empty for the latest one
+ * @param dir Where to save the archive
+ * @returns Path of the chart archive
+ */
+func pullChart(chart, repo, version, dir string) string {
+	flags := []string{"pull", chart, "--repo", repo, "--destination", dir, "--devel"}
+	if version != "" {
+		flags = append(flags, "--version", version)
+	}
+	RunHelmCmdWithRetry(flags...)
+
+	archives, err := filepath.Glob(filepath.Join(dir, chart+"-*.tgz"))
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(archives).To(HaveLen(1), "Expected one %s chart archive in %s", chart, dir)
+	return archives[0]
+}
+
+// renderedChartImages returns the images of a rendered chart
+func renderedChartImages(chart string, args ...string) []string {
+	out, err := kubectl.RunHelmBinaryWithOutput(append([]string{"template", "images", chart}, args...)...)
+	Expect(err).To(Not(HaveOccurred()), out)
+
+	var images []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "- ")), ":")
+		if !found || key != "image" {
+			continue
+		}
+		image := strings.Trim(strings.TrimSpace(value), `"'`)
+		if image != "" && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// runSudo runs a command as root
+func runSudo(args ...string) {
+	Expect(install.RunSudo(args...)).To(Succeed())
+}
+
+var _ = Describe("E2E - Airgap Install Rancher Manager", Label("airgap-install"), func() {
+	BeforeEach(func() {
+		// Images are resolved like the precheck, from a released Rancher >= 2.13
+		if rancherChannel == "head" || isRancherManagerVersion("<2.13") {
+			Skip(fmt.Sprintf("Skipping airgap install: requires a released Rancher >= 2.13 (channel=%q, version=%s)", rancherChannel, rancherVersion))
+		}
+		Expect(airgapRegistry).To(Not(BeEmpty()), "AIRGAP_REGISTRY must be set, e.g. localhost:5000")
+	})
+
+	It("Install Rancher Manager and Turtles from a local registry", Label("qase:749"), func() {
+		artifactsDir := os.Getenv("AIRGAP_ARTIFACTS_DIR")
+		if artifactsDir == "" {
+			artifactsDir = filepath.Join(os.TempDir(), "turtles-airgap")
+		}
+		Expect(os.MkdirAll(artifactsDir, 0o755)).To(Succeed())
+
+		var (
+			release          *precheck.Release
+			certManagerChart string
+			rancherChart     string
+			images           = mirror.List{}
+		)
+
+		checkHost(hostPreflight(install.PreflightMode{Airgap: true}))
+
+		By("Resolving the images of the release", func() {
+			var err error
+			release, err = precheck.Resolve(sourceFetcher.Get, rancherVersion, isCommunityPrecheck())
+			Expect(err).To(Not(HaveOccurred()))
+			GinkgoWriter.Printf("Turtles %s, providers %v\n", release.TurtlesVersion, release.Providers)
+
+			source := imageRegistry(release)
+			for _, i := range release.Images() {
+				Expect(i.Tag).To(Not(BeEmpty()), "No version resolved for %s", i.Repo)
+				images.Add(source, i.String(), airgapRegistry, strings.HasPrefix(i.Repo, "rancher/charts/"))
+			}
+			// Components are always stored on prime registry, even for rc/alpha releases
+			for _, c := range release.Components() {
+				images.Add(primeRegistry, c.String(), airgapRegistry, true)
+			}
+
+			// Rancher images, or a smaller list for quicker runs
+			var list []byte
+			if file := os.Getenv("AIRGAP_IMAGE_LIST"); file != "" {
+				list, err = os.ReadFile(file)
+				Expect(err).To(Not(HaveOccurred()))
+			} else if release.Community {
+				list = fetchBytes(fmt.Sprintf("https://github.com/rancher/rancher/releases/download/v%s/rancher-images.txt", rancherVersion))
+			} else {
+				list = fetchBytes(fmt.Sprintf("%s/rancher/v%s/rancher-images.txt", primeArtifactsURL, rancherVersion))
+			}
+			for _, ref := range mirror.ParseList(list) {
+				images.Add(source, ref, airgapRegistry, false)
+			}
+
+			// Full references, e.g. the devel turtles image
+			for _, ref := range strings.Fields(os.Getenv("AIRGAP_EXTRA_IMAGES")) {
+				images.AddRef(ref, airgapRegistry, false)
+			}
+		})
+
+		By("Downloading the K3s, cert-manager and Rancher artifacts", func() {
+			downloadK3sInstaller(filepath.Join(artifactsDir, install.K3sInstallerFile))
+			for file, artifactURL := range k3sAirgapArtifacts() {
+				if _, err := os.Stat(filepath.Join(artifactsDir, file)); err == nil {
+					continue
+				}
+				Eventually(func() error {
+					return tools.GetFileFromURL(artifactURL, filepath.Join(artifactsDir, file), true)
+				}, tools.SetTimeout(5*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
+			}
+
+			certManagerChart = pullChart("cert-manager", "https://charts.jetstack.io", CertManagerVersion, artifactsDir)
+			for _, ref := range renderedChartImages(certManagerChart, "--namespace", "cert-manager", "--set", "crds.enabled=true") {
+				images.AddRef(ref, airgapRegistry, false)
+			}
+			rancherChart = pullChart("rancher", rancherChartRepoURL(), rancherVersion, artifactsDir)
+		})
+
+		By("Populating the local registry", func() {
+			running, err := install.EnsureRegistry(airgapRegistry, filepath.Join(artifactsDir, "registry"))
+			Expect(err).To(Not(HaveOccurred()))
+			if running {
+				GinkgoWriter.Printf("Using running registry %s\n", airgapRegistry)
+			}
+
+			sorted := images.Sorted()
+			GinkgoWriter.Printf("Copying %d images to %s\n", len(sorted), airgapRegistry)
+			// The local registry is plain HTTP, source registries use the configured credentials
+			opts := append(registryAuth.CraneOptions(airgapRegistry), crane.Insecure)
+			errs := mirror.Copy(sorted, airgapCopyWorkers, &v1.Platform{OS: "linux", Architecture: airgapArch()}, opts...)
+			for _, err := range errs {
+				GinkgoWriter.Printf("❌ %v\n", err)
+			}
+			Expect(errs).To(BeEmpty(), "%d image(s) could not be copied to %s", len(errs), airgapRegistry)
+		})
+
+		By("Blocking outbound traffic", func() {
+			install.UnblockEgress()
+			Expect(install.BlockEgress()).To(Succeed())
+			if os.Getenv("AIRGAP_KEEP_EGRESS_BLOCKED") != "true" {
+				DeferCleanup(install.UnblockEgress)
+			}
+
+			client := &http.Client{Timeout: 10 * time.Second}
+			_, err := client.Get("https://github.com")
+			Expect(err).To(HaveOccurred(), "Outbound traffic is not blocked")
+		})
+
+		By("Installing K3s from local artifacts", func() {
+			// Images keeping their upstream registry in manifests are pulled from the local registry too
+			registries := "mirrors:\n"
+			for _, source := range []string{airgapRegistry, "docker.io", "quay.io", primeRegistry, stgPrimeRegistry} {
+				if source == "" || strings.Contains(registries, fmt.Sprintf("%q:", source)) {
+					continue
+				}
+				registries += fmt.Sprintf("  %q:\n    endpoint:\n      - \"http://%s\"\n", source, airgapRegistry)
+			}
+			registriesFile := filepath.Join(artifactsDir, "registries.yaml")
+			Expect(os.WriteFile(registriesFile, []byte(registries), 0o644)).To(Succeed())
+			runSudo("install", "-D", "-m", "0644", registriesFile, "/etc/rancher/k3s/registries.yaml")
+
+			for file := range k3sAirgapArtifacts() {
+				if file == "k3s" {
+					runSudo("install", "-D", "-m", "0755", filepath.Join(artifactsDir, file), "/usr/local/bin/k3s")
+					continue
+				}
+				runSudo("install", "-D", "-m", "0644", filepath.Join(artifactsDir, file), "/var/lib/rancher/k3s/agent/images/"+file)
+			}
+			runK3sInstaller(filepath.Join(artifactsDir, install.K3sInstallerFile), "INSTALL_K3S_SKIP_DOWNLOAD=true")
+		})
+
+		By("Starting K3s", func() {
+			Expect(install.StartK3s()).To(Succeed())
+			waitForDeployments(install.K3sDeployments)
+		})
+
+		By("Installing CertManager from the local registry", func() {
+			var flags []string
+			for _, component := range []struct{ key, image string }{
+				{"image", "cert-manager-controller"},
+				{"webhook.image", "cert-manager-webhook"},
+				{"cainjector.image", "cert-manager-cainjector"},
+				{"startupapicheck.image", "cert-manager-startupapicheck"},
+			} {
+				flags = append(flags, "--set", fmt.Sprintf("%s.repository=%s/jetstack/%s", component.key, airgapRegistry, component.image))
+			}
+			out, err := install.InstallCertManager(certManagerChart, flags...)
+			GinkgoWriter.Write([]byte(out))
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		By("Installing Rancher Manager from the local registry", func() {
+			RunHelmCmdWithRetry(
+				"upgrade", "--install", "rancher", rancherChart,
+				"--namespace", "cattle-system",
+				"--create-namespace",
+				"--set", "hostname="+rancherHostname,
+				"--set", "bootstrapPassword="+rancherBootstrapPassword,
+				"--set", "replicas=1",
+				"--set", "rancherImage="+airgapRegistry+"/rancher/rancher",
+				"--set", "systemDefaultRegistry="+airgapRegistry,
+				// The system charts repository on GitHub is not reachable
+				"--set", "useBundledSystemChart=true",
+				"--wait", "--timeout", "10m",
+			)
+
+			if turtlesDevChart {
+				patchRancherTurtlesConfig(airgapRegistry)
+			}
+		})
+
+		By("Waiting for Rancher Manager and Turtles", func() {
+			waitForResourceCondition("cattle-system", "deployments/rancher-webhook", "Available")
+			waitForDeployments(install.TurtlesDeployments)
+			checkRancherReady(nil)
+			waitForCAPIProvidersReady([]string{capiNamespace + "/cluster-api"})
+		})
+
+		// Community channels do not ship the providers chart
+		if release.Community {
+			return
+		}
+
+		By("Installing the providers chart from the local registry", func() {
+			providersChartRegistry = airgapRegistry
+			providersChartPlainHTTP = true
+			installProvidersChart(strings.ReplaceAll(release.TurtlesChartVersion, "_", "+"), airgapRegistry)
+		})
+
+		checkChartProviders()
+	})
+})
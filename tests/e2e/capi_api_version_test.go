@@ -0,0 +1,220 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+)
+
+const apiRoundTripClusterName = "turtles-qa-api-roundtrip"
+
+type crdVersionInfo struct {
+	Spec struct {
+		Versions []struct {
+			Name    string `json:"name"`
+			Served  bool   `json:"served"`
+			Storage bool   `json:"storage"`
+		} `json:"versions"`
+	} `json:"spec"`
+	Status struct {
+		StoredVersions []string `json:"storedVersions"`
+	} `json:"status"`
+}
+
+// served returns the names of all served versions
+func (c *crdVersionInfo) served() []string {
+	var versions []string
+	for _, v := range c.Spec.Versions {
+		if v.Served {
+			versions = append(versions, v.Name)
+		}
+	}
+	return versions
+}
+
+// storage returns the name of the storage version
+func (c *crdVersionInfo) storage() string {
+	for _, v := range c.Spec.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+/**
+ * Get the versions of a CRD
+ * @param name Name of the CRD
+ * @returns CRD versions, or nil if the CRD is not installed
+ */
+func getCRDVersions(name string) *crdVersionInfo {
+	out, err := kubectl.Run("get", "crd", name, "--ignore-not-found", "-o", "json")
+	Expect(err).To(Not(HaveOccurred()), "Unable to get CRD %s: %s", name, out)
+	if strings.TrimSpace(out) == "" {
+		return nil
+	}
+
+	crd := &crdVersionInfo{}
+	Expect(json.Unmarshal([]byte(out), crd)).To(Succeed())
+	return crd
+}
+
+// expectedCAPIVersions returns the versions every CAPI CRD should serve and store, from the CAPI version of the compatibility matrix
+func expectedCAPIVersions() (served []string, storage string) {
+	// v1beta2 API is available starting with CAPI v1.11, v1beta1 is still served
+	storage, err := compatibility.CAPIAPIVersion()
+	Expect(err).To(Not(HaveOccurred()))
+	if storage == "v1beta1" {
+		return []string{"v1beta1"}, storage
+	}
+	return []string{"v1beta1", storage}, storage
+}
+
+var _ = Describe("E2E - CAPI API versions", Label("apiversion"), func() {
+	BeforeEach(func() {
+		if isRancherManagerVersion("<2.13") {
+			Skip(fmt.Sprintf("Skipping CAPI API versions checks: requires Rancher >= 2.13 (version=%s)", rancherVersion))
+		}
+	})
+
+	It("Check served and storage versions of CAPI CRDs", func() {
+		served, storage := expectedCAPIVersions()
+
+		// Core CRDs are always installed, bootstrap/controlplane ones depend on the enabled providers
+		coreCRDs := []string{
+			"clusters.cluster.x-k8s.io",
+			"clusterclasses.cluster.x-k8s.io",
+			"machines.cluster.x-k8s.io",
+			"machinedeployments.cluster.x-k8s.io",
+		}
+		providerCRDs := []string{
+			"kubeadmconfigs.bootstrap.cluster.x-k8s.io",
+			"kubeadmconfigtemplates.bootstrap.cluster.x-k8s.io",
+			"kubeadmcontrolplanes.controlplane.cluster.x-k8s.io",
+			"kubeadmcontrolplanetemplates.controlplane.cluster.x-k8s.io",
+			"rke2configs.bootstrap.cluster.x-k8s.io",
+			"rke2configtemplates.bootstrap.cluster.x-k8s.io",
+			"rke2controlplanes.controlplane.cluster.x-k8s.io",
+			"rke2controlplanetemplates.controlplane.cluster.x-k8s.io",
+		}
+
+		for _, name := range append(coreCRDs, providerCRDs...) {
+			By(fmt.Sprintf("Checking %s", name), func() {
+				crd := getCRDVersions(name)
+				if crd == nil {
+					Expect(coreCRDs).To(Not(ContainElement(name)), "Core CAPI CRD %s is not installed", name)
+					GinkgoWriter.Printf("CRD %s not installed, skipping\n", name)
+					return
+				}
+
+				GinkgoWriter.Printf("CRD %s: served=%v storage=%s storedVersions=%v\n", name, crd.served(), crd.storage(), crd.Status.StoredVersions)
+				Expect(crd.served()).To(ContainElements(served), "Unexpected served versions for %s", name)
+				Expect(crd.storage()).To(Equal(storage), "Unexpected storage version for %s", name)
+
+				// After an upgrade, objects still stored at an older version mean storage migration did not complete
+				if isUpgradeTest {
+					Expect(crd.Status.StoredVersions).To(ConsistOf(storage), "Objects of %s are still stored at an older version", name)
+				}
+			})
+		}
+	})
+
+	It("Round-trip a v1beta1 Cluster through v1beta2", func() {
+		served, _ := expectedCAPIVersions()
+		if !slices.Contains(served, "v1beta2") {
+			Skip("Skipping round-trip: v1beta2 is not served")
+		}
+
+		DeferCleanup(func() {
+			_, _ = kubectl.Run("delete", capiClustersResource, apiRoundTripClusterName, "--namespace", "default", "--ignore-not-found")
+		})
+
+		By("Creating a Cluster at v1beta1", func() {
+			kubectlApply(fmt.Sprintf(`apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  name: %s
+  namespace: default
+  labels:
+    turtles-e2e/roundtrip: "true"
+spec:
+  paused: true
+  clusterNetwork:
+    pods:
+      cidrBlocks:
+      - 10.45.0.0/16
+    services:
+      cidrBlocks:
+      - 10.46.0.0/16
+    serviceDomain: cluster.local
+  controlPlaneEndpoint:
+    host: 192.0.2.10
+    port: 6443
+`, apiRoundTripClusterName))
+		})
+
+		By("Reading the Cluster back at v1beta2", func() {
+			out, err := kubectl.Run("get", "clusters.v1beta2.cluster.x-k8s.io", apiRoundTripClusterName, "--namespace", "default", "-o", "json")
+			Expect(err).To(Not(HaveOccurred()), out)
+
+			var cluster struct {
+				APIVersion string `json:"apiVersion"`
+				Metadata   struct {
+					Labels map[string]string `json:"labels"`
+				} `json:"metadata"`
+				Spec struct {
+					Paused         *bool `json:"paused"`
+					ClusterNetwork struct {
+						Pods struct {
+							CIDRBlocks []string `json:"cidrBlocks"`
+						} `json:"pods"`
+						Services struct {
+							CIDRBlocks []string `json:"cidrBlocks"`
+						} `json:"services"`
+						ServiceDomain string `json:"serviceDomain"`
+					} `json:"clusterNetwork"`
+					ControlPlaneEndpoint struct {
+						Host string `json:"host"`
+						Port int    `json:"port"`
+					} `json:"controlPlaneEndpoint"`
+				} `json:"spec"`
+			}
+			Expect(json.Unmarshal([]byte(out), &cluster)).To(Succeed())
+
+			Expect(cluster.APIVersion).To(Equal("cluster.x-k8s.io/v1beta2"))
+			Expect(cluster.Metadata.Labels).To(HaveKeyWithValue("turtles-e2e/roundtrip", "true"))
+			Expect(cluster.Spec.Paused).To(HaveValue(BeTrue()))
+			Expect(cluster.Spec.ClusterNetwork.Pods.CIDRBlocks).To(ConsistOf("10.45.0.0/16"))
+			Expect(cluster.Spec.ClusterNetwork.Services.CIDRBlocks).To(ConsistOf("10.46.0.0/16"))
+			Expect(cluster.Spec.ClusterNetwork.ServiceDomain).To(Equal("cluster.local"))
+			Expect(cluster.Spec.ControlPlaneEndpoint.Host).To(Equal("192.0.2.10"))
+			Expect(cluster.Spec.ControlPlaneEndpoint.Port).To(Equal(6443))
+		})
+
+		By("Reading the Cluster back at v1beta1", func() {
+			out, err := kubectl.Run("get", "clusters.v1beta1.cluster.x-k8s.io", apiRoundTripClusterName, "--namespace", "default",
+				"-o", "jsonpath={.spec.clusterNetwork.pods.cidrBlocks[0]} {.spec.controlPlaneEndpoint.host}:{.spec.controlPlaneEndpoint.port}")
+			Expect(err).To(Not(HaveOccurred()), out)
+			Expect(out).To(Equal("10.45.0.0/16 192.0.2.10:6443"))
+		})
+	})
+})
@@ -0,0 +1,215 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+)
+
+const (
+	turtlesFeature             = "turtles"
+	embeddedCAPIFeature        = "embedded-cluster-api"
+	turtlesNamespace           = "cattle-turtles-system"
+	capiNamespace              = "cattle-capi-system"
+	capiProvisioningNamespace  = "cattle-provisioning-capi-system"
+	turtlesRelease             = "rancher-turtles"
+	capiProvisioningRelease    = "rancher-provisioning-capi"
+	turtlesControllerManager   = "rancher-turtles-controller-manager"
+	capiControllerManager      = "capi-controller-manager"
+	capiClustersResource       = "clusters.cluster.x-k8s.io"
+	rancherFeatureResource     = "features.management.cattle.io"
+	rancherFeatureSwitchPeriod = 10 * time.Second
+)
+
+/**
+ * Enable or disable a Rancher feature, and wait for Rancher to restart with it
+ * @param name Name of the management.cattle.io/v3 Feature
+ * @param value Desired value of the feature
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func setRancherFeature(name string, value bool) {
+	current := rancherFeatureValue(name)
+	restarts := rancherRestarts()
+
+	kubectlApply(fmt.Sprintf(`apiVersion: management.cattle.io/v3
+kind: Feature
+metadata:
+  name: %s
+spec:
+  value: %t
+`, name, value))
+	if current == value {
+		GinkgoWriter.Printf("Feature %s is already %t\n", name, value)
+		return
+	}
+
+	// Rancher restarts its own process when a non-dynamic feature is changed, without a new rollout
+	Eventually(func() int {
+		return rancherRestarts()
+	}, tools.SetTimeout(5*time.Minute), rancherFeatureSwitchPeriod).Should(BeNumerically(">", restarts), "Rancher did not restart after switching feature %s", name)
+
+	out, err := kubectl.Run("wait", "pods", "--namespace", "cattle-system", "--selector", "app=rancher", "--for=condition=Ready", "--timeout=600s")
+	Expect(err).To(Not(HaveOccurred()), out)
+	Expect(install.WaitForRancherPing(rancherHostname, 10*time.Minute)).To(Succeed())
+}
+
+// rancherFeatureValue returns the value of a Rancher feature, its default when not set
+func rancherFeatureValue(name string) bool {
+	out, err := kubectl.Run("get", rancherFeatureResource, name, "-o", "jsonpath={.spec.value}/{.status.default}")
+	Expect(err).To(Not(HaveOccurred()), out)
+	value, def, _ := strings.Cut(strings.TrimSpace(out), "/")
+	if value == "" {
+		value = def
+	}
+	return value == "true"
+}
+
+// rancherRestarts returns the restarts of the rancher containers, summed over the Rancher pods
+func rancherRestarts() int {
+	out, err := kubectl.Run("get", "pods", "--namespace", "cattle-system", "--selector", "app=rancher",
+		"-o", `jsonpath={range .items[*]}{.status.containerStatuses[?(@.name=="rancher")].restartCount}{" "}{end}`)
+	Expect(err).To(Not(HaveOccurred()), out)
+	restarts := 0
+	for _, f := range strings.Fields(out) {
+		n, err := strconv.Atoi(f)
+		Expect(err).To(Not(HaveOccurred()), out)
+		restarts += n
+	}
+	return restarts
+}
+
+/**
+ * Check if a Rancher feature exists
+ * @param name Name of the management.cattle.io/v3 Feature
+ * @returns true if the feature exists, false otherwise
+ */
+func rancherFeatureExists(name string) bool {
+	out, err := kubectl.Run("get", rancherFeatureResource, name, "--ignore-not-found", "-o", "name")
+	Expect(err).To(Not(HaveOccurred()), out)
+	return strings.TrimSpace(out) != ""
+}
+
+/**
+ * Wait for a deployment to be removed
+ * @param ns Namespace of the deployment
+ * @param name Name of the deployment
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func waitForDeploymentRemoval(ns, name string) {
+	Eventually(func() (string, error) {
+		out, err := kubectl.Run("get", "deployment", name, "--namespace", ns, "--ignore-not-found", "-o", "name")
+		return strings.TrimSpace(out), err
+	}, tools.SetTimeout(10*time.Minute), rancherFeatureSwitchPeriod).Should(BeEmpty(), "Deployment %s/%s still exists", ns, name)
+}
+
+// checkTurtlesActive verifies that Turtles manages CAPI and the embedded CAPI chart is gone
+func checkTurtlesActive() {
+	Eventually(func() (bool, error) {
+		release, err := install.HelmRelease(turtlesNamespace, turtlesRelease)
+		return release.Deployed(), err
+	}, tools.SetTimeout(10*time.Minute), rancherFeatureSwitchPeriod).Should(BeTrue(), "%s release is not deployed", turtlesRelease)
+	waitForResourceCondition(turtlesNamespace, "deployments/"+turtlesControllerManager, "Available")
+	waitForResourceCondition(capiNamespace, "deployments/"+capiControllerManager, "Available")
+
+	release, err := install.HelmRelease(capiProvisioningNamespace, capiProvisioningRelease)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(release.Deployed()).To(BeFalse(), "%s release is still deployed", capiProvisioningRelease)
+	waitForDeploymentRemoval(capiProvisioningNamespace, capiControllerManager)
+}
+
+// checkEmbeddedCAPIActive verifies that the embedded CAPI chart manages CAPI and Turtles is gone
+func checkEmbeddedCAPIActive() {
+	Eventually(func() (bool, error) {
+		release, err := install.HelmRelease(capiProvisioningNamespace, capiProvisioningRelease)
+		return release.Deployed(), err
+	}, tools.SetTimeout(10*time.Minute), rancherFeatureSwitchPeriod).Should(BeTrue(), "%s release is not deployed", capiProvisioningRelease)
+	waitForResourceCondition(capiProvisioningNamespace, "deployments/"+capiControllerManager, "Available")
+
+	release, err := install.HelmRelease(turtlesNamespace, turtlesRelease)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(release.Deployed()).To(BeFalse(), "%s release is still deployed", turtlesRelease)
+	waitForDeploymentRemoval(turtlesNamespace, turtlesControllerManager)
+}
+
+var _ = Describe("E2E - Switch CAPI feature flags", Label("switch"), Ordered, func() {
+	var (
+		capiClusters  []string
+		capiProviders []string
+	)
+
+	BeforeAll(func() {
+		if isRancherManagerVersion("<2.13") || !rancherFeatureExists(embeddedCAPIFeature) {
+			Skip(fmt.Sprintf("Skipping CAPI feature switch: requires Rancher >= 2.13 with the %s feature (version=%s)", embeddedCAPIFeature, rancherVersion))
+		}
+	})
+
+	It("Check initial state", func() {
+		By("Checking Turtles is active", func() {
+			checkTurtlesActive()
+		})
+
+		By("Recording existing CAPI clusters and providers", func() {
+			capiClusters = listResources(capiClustersResource)
+			capiProviders = listResources(install.CAPIProvidersResource)
+			GinkgoWriter.Printf("CAPI clusters: %v\nCAPIProviders: %v\n", capiClusters, capiProviders)
+		})
+	})
+
+	It("Switch to embedded CAPI", func() {
+		By("Enabling embedded-cluster-api and disabling turtles", func() {
+			setRancherFeature(embeddedCAPIFeature, true)
+			setRancherFeature(turtlesFeature, false)
+		})
+
+		By("Checking embedded CAPI is active", func() {
+			checkEmbeddedCAPIActive()
+		})
+
+		By("Checking CAPI clusters are preserved", func() {
+			Expect(listResources(capiClustersResource)).To(Equal(capiClusters))
+		})
+	})
+
+	It("Switch back to Turtles", func() {
+		By("Disabling embedded-cluster-api and enabling turtles", func() {
+			setRancherFeature(embeddedCAPIFeature, false)
+			setRancherFeature(turtlesFeature, true)
+		})
+
+		By("Checking Turtles is active", func() {
+			checkTurtlesActive()
+		})
+
+		By("Checking CAPI clusters are preserved", func() {
+			Expect(listResources(capiClustersResource)).To(Equal(capiClusters))
+		})
+
+		By("Checking CAPIProviders are preserved and Ready", func() {
+			Eventually(func() []string {
+				return listResources(install.CAPIProvidersResource)
+			}, tools.SetTimeout(5*time.Minute), rancherFeatureSwitchPeriod).Should(Equal(capiProviders))
+			waitForCAPIProvidersReady(capiProviders)
+		})
+	})
+})
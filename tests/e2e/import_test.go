@@ -0,0 +1,311 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+)
+
+const (
+	fakeClusterName       = "turtles-qa-fake"
+	fakeClusterNS         = "capi-clusters"
+	fakeClusterKindNet    = "kind"
+	fakeClusterAPIPort    = "6443"
+	capiClusterOwnerKey   = "cluster-api.cattle.io/capi-cluster-owner"
+	capiClusterOwnerNSKey = "cluster-api.cattle.io/capi-cluster-owner-ns"
+)
+
+// fakeCAPICluster is a CAPI Cluster without any infrastructure provider behind it.
+// Its kubeconfig Secret points at a throwaway kind cluster, so Turtles sees it as
+// a provisioned cluster and imports it like any other CAPI cluster.
+type fakeCAPICluster struct {
+	name       string
+	namespace  string
+	apiVersion string
+	kubeconfig string
+}
+
+func newFakeCAPICluster(name, namespace string) *fakeCAPICluster {
+	// The CAPI version shipped with the tested Rancher minor
+	version, err := compatibility.CAPIAPIVersion()
+	Expect(err).To(Not(HaveOccurred()))
+
+	return &fakeCAPICluster{
+		name:       name,
+		namespace:  namespace,
+		apiVersion: "cluster.x-k8s.io/" + version,
+		kubeconfig: filepath.Join(os.TempDir(), name+".kubeconfig"),
+	}
+}
+
+// kubectl runs kubectl against the throwaway workload cluster
+func (c *fakeCAPICluster) kubectl(args ...string) (string, error) {
+	return kubectl.Run(append([]string{"--kubeconfig", c.kubeconfig}, args...)...)
+}
+
+// Create starts the kind cluster and registers it as a CAPI Cluster with a Ready control plane
+func (c *fakeCAPICluster) Create() {
+	By("Creating the throwaway workload cluster", func() {
+		// Same Kubernetes version as the kind clusters of the Cypress specs
+		out, err := exec.Command("kind", "create", "cluster",
+			"--name", c.name,
+			"--image", "kindest/node:"+compatibility.Kubernetes.Kind,
+			"--kubeconfig", c.kubeconfig,
+			"--wait", "2m").CombinedOutput()
+		GinkgoWriter.Printf("kind create cluster output:\n%s\n", out)
+		Expect(err).To(Not(HaveOccurred()))
+	})
+
+	// Pods of the upstream cluster cannot resolve the kind node name, but they can
+	// reach the kind docker network. The node IP is part of the API server certificate.
+	var nodeIP string
+	By("Building a kubeconfig reachable from the upstream cluster", func() {
+		out, err := exec.Command("docker", "inspect", "-f",
+			fmt.Sprintf("{{ .NetworkSettings.Networks.%s.IPAddress }}", fakeClusterKindNet),
+			c.name+"-control-plane").Output()
+		Expect(err).To(Not(HaveOccurred()))
+		nodeIP = strings.TrimSpace(string(out))
+		Expect(nodeIP).To(Not(BeEmpty()), "kind node %s-control-plane has no IP", c.name)
+
+		out, err = exec.Command("kind", "get", "kubeconfig", "--internal", "--name", c.name).Output()
+		Expect(err).To(Not(HaveOccurred()))
+		internal := strings.ReplaceAll(string(out), "https://"+c.name+"-control-plane:"+fakeClusterAPIPort, "https://"+nodeIP+":"+fakeClusterAPIPort)
+
+		kubeconfigSecret := fmt.Sprintf(`apiVersion: v1
+kind: Secret
+type: cluster.x-k8s.io/secret
+metadata:
+  name: %[1]s-kubeconfig
+  namespace: %[2]s
+  labels:
+    cluster.x-k8s.io/cluster-name: %[1]s
+data:
+  value: %[3]s
+`, c.name, c.namespace, base64.StdEncoding.EncodeToString([]byte(internal)))
+
+		_, _ = kubectl.Run("create", "namespace", c.namespace)
+		kubectlApply(kubeconfigSecret)
+	})
+
+	By("Creating the CAPI Cluster", func() {
+		cluster := fmt.Sprintf(`apiVersion: %[3]s
+kind: Cluster
+metadata:
+  name: %[1]s
+  namespace: %[2]s
+  labels:
+    cluster-api.cattle.io/rancher-auto-import: "true"
+spec:
+  controlPlaneEndpoint:
+    host: %[4]s
+    port: %[5]s
+`, c.name, c.namespace, c.apiVersion, nodeIP, fakeClusterAPIPort)
+		kubectlApply(cluster)
+	})
+
+	By("Marking the CAPI Cluster control plane as Ready", func() {
+		Eventually(c.markReady, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(Succeed())
+	})
+}
+
+/**
+ * Patch the CAPI Cluster status as if its control plane was Ready, and check the patch is kept
+ * The CAPI controllers may recompute the status, e.g. v1beta2 resets the initialization and conditions,
+ * so callers retry it until the import is done.
+ * @returns Error when the patch fails or the status was reset
+ */
+func (c *fakeCAPICluster) markReady() error {
+	resource := "clusters." + strings.Split(c.apiVersion, "/")[1] + ".cluster.x-k8s.io"
+	status := `{"status":{"controlPlaneReady":true,"infrastructureReady":true,"phase":"Provisioned"}}`
+	field := "{.status.controlPlaneReady}"
+	if c.apiVersion == "cluster.x-k8s.io/v1beta2" {
+		status = `{"status":{"initialization":{"controlPlaneInitialized":true,"infrastructureProvisioned":true},"phase":"Provisioned"}}`
+		field = "{.status.initialization.controlPlaneInitialized}"
+	}
+
+	out, err := kubectl.Run("patch", resource, c.name, "--namespace", c.namespace,
+		"--subresource=status", "--type", "merge", "-p", status)
+	if err != nil {
+		return fmt.Errorf("patching CAPI Cluster status: %w: %s", err, out)
+	}
+	out, err = kubectl.Run("get", resource, c.name, "--namespace", c.namespace, "-o", "jsonpath="+field)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(out) != "true" {
+		return fmt.Errorf("CAPI Cluster %s/%s status was reset", c.namespace, c.name)
+	}
+	return nil
+}
+
+// Delete removes the CAPI Cluster and the throwaway kind cluster
+func (c *fakeCAPICluster) Delete() {
+	_, _ = kubectl.Run("delete", capiClustersResource, c.name, "--namespace", c.namespace, "--ignore-not-found", "--timeout=300s")
+	_, _ = kubectl.Run("delete", "secret", c.name+"-kubeconfig", "--namespace", c.namespace, "--ignore-not-found")
+
+	out, err := exec.Command("kind", "delete", "cluster", "--name", c.name).CombinedOutput()
+	GinkgoWriter.Printf("kind delete cluster output:\n%s\n", out)
+	Expect(err).To(Not(HaveOccurred()))
+	_ = os.Remove(c.kubeconfig)
+}
+
+// v3Cluster returns the name of the Rancher v3 cluster owned by the CAPI Cluster, if any
+func (c *fakeCAPICluster) v3Cluster() (string, error) {
+	out, err := kubectl.Run("get", "clusters.management.cattle.io",
+		"-l", capiClusterOwnerKey+"="+c.name+","+capiClusterOwnerNSKey+"="+c.namespace,
+		"-o", "jsonpath={.items[*].metadata.name}")
+	return strings.TrimSpace(out), err
+}
+
+// WaitForImport waits until Rancher has imported the cluster and its agent is running
+func (c *fakeCAPICluster) WaitForImport() {
+	Eventually(func() (string, error) {
+		// Turtles only imports a Cluster with a Ready control plane, keep it so until then
+		if err := c.markReady(); err != nil {
+			return "", err
+		}
+		return c.v3Cluster()
+	}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(Not(BeEmpty()), "Rancher v3 cluster not created for %s/%s", c.namespace, c.name)
+
+	Eventually(func() (string, error) {
+		return c.kubectl("get", "deployment", "cattle-cluster-agent",
+			"--namespace", "cattle-system",
+			"-o", "jsonpath={.status.conditions[?(@.type==\"Available\")].status}")
+	}, tools.SetTimeout(10*time.Minute), 10*time.Second).Should(Equal("True"), "cattle-cluster-agent is not Available in %s", c.name)
+
+	Eventually(func() (string, error) {
+		v3, err := c.v3Cluster()
+		if err != nil {
+			return "", err
+		}
+		return kubectl.Run("get", "clusters.management.cattle.io", v3,
+			"-o", "jsonpath={.status.conditions[?(@.type==\"Ready\")].status}")
+	}, tools.SetTimeout(10*time.Minute), 10*time.Second).Should(Equal("True"), "Rancher v3 cluster for %s is not Ready", c.name)
+
+	v3, err := c.v3Cluster()
+	Expect(err).To(Not(HaveOccurred()))
+	version, err := kubectl.Run("get", "clusters.management.cattle.io", v3, "-o", "jsonpath={.status.version.gitVersion}")
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(version).To(Equal(compatibility.Kubernetes.Kind), "Rancher v3 cluster for %s does not run the Kubernetes version of the compatibility matrix", c.name)
+}
+
+// CheckAgentTrust checks cattle-cluster-agent trusts the certificate chain served by Rancher
+func (c *fakeCAPICluster) CheckAgentTrust() {
+	cacerts, err := install.RancherCACerts()
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(install.VerifyRancherChain(rancherHostname, cacerts)).To(Succeed())
+
+	// The agent refuses to start when the CA it downloads from Rancher does not match its checksum
+	checksum, err := c.kubectl("get", "deployment", "cattle-cluster-agent", "--namespace", "cattle-system",
+		"-o", `jsonpath={.spec.template.spec.containers[0].env[?(@.name=="CATTLE_CA_CHECKSUM")].value}`)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(checksum).To(Equal(install.CAChecksum(cacerts)), "cattle-cluster-agent CA checksum does not match the Rancher cacerts")
+
+	logs, err := c.kubectl("logs", "deployment/cattle-cluster-agent", "--namespace", "cattle-system", "--since=10m")
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(logs).To(Not(ContainSubstring("x509:")), "cattle-cluster-agent does not trust the Rancher certificate")
+}
+
+var _ = Describe("E2E - Import fake CAPI cluster", Label("import"), Ordered, func() {
+	var cluster *fakeCAPICluster
+
+	BeforeAll(func() {
+		if isRancherManagerVersion("<2.13") {
+			Skip(fmt.Sprintf("Skipping fake cluster import: requires Rancher >= 2.13 (version=%s)", rancherVersion))
+		}
+
+		cluster = newFakeCAPICluster(fakeClusterName, fakeClusterNS)
+		cluster.Create()
+	})
+
+	AfterAll(func() {
+		if cluster != nil {
+			cluster.Delete()
+		}
+	})
+
+	It("Import CAPI cluster", func() {
+		By("Waiting for the cluster to be imported", func() {
+			cluster.WaitForImport()
+		})
+
+		By("Checking cattle-cluster-agent trusts the Rancher certificate chain", func() {
+			cluster.CheckAgentTrust()
+		})
+
+		By("Checking the CAPI cluster is annotated as imported", func() {
+			out, err := kubectl.Run("get", capiClustersResource, cluster.name,
+				"--namespace", cluster.namespace,
+				"-o", "jsonpath={.metadata.annotations.imported}")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(out).To(Equal("true"))
+		})
+	})
+
+	It("Re-import CAPI cluster", func() {
+		By("Deleting the Rancher v3 cluster", func() {
+			v3, err := cluster.v3Cluster()
+			Expect(err).To(Not(HaveOccurred()))
+			out, err := kubectl.Run("delete", "clusters.management.cattle.io", v3, "--timeout=300s")
+			Expect(err).To(Not(HaveOccurred()), out)
+
+			Eventually(func() (string, error) {
+				return cluster.v3Cluster()
+			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(BeEmpty())
+		})
+
+		By("Checking the CAPI cluster is not re-imported while annotated", func() {
+			Consistently(func() (string, error) {
+				return cluster.v3Cluster()
+			}, 1*time.Minute, 10*time.Second).Should(BeEmpty())
+		})
+
+		By("Removing the imported annotation", func() {
+			out, err := kubectl.Run("annotate", capiClustersResource, cluster.name,
+				"--namespace", cluster.namespace, "imported-")
+			Expect(err).To(Not(HaveOccurred()), out)
+		})
+
+		By("Waiting for the cluster to be imported again", func() {
+			cluster.WaitForImport()
+		})
+	})
+
+	It("Delete CAPI cluster", func() {
+		By("Deleting the CAPI cluster", func() {
+			out, err := kubectl.Run("delete", capiClustersResource, cluster.name,
+				"--namespace", cluster.namespace, "--timeout=300s")
+			Expect(err).To(Not(HaveOccurred()), out)
+		})
+
+		By("Checking the Rancher v3 cluster is removed", func() {
+			Eventually(func() (string, error) {
+				return cluster.v3Cluster()
+			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(BeEmpty())
+		})
+	})
+})
@@ -1,5 +1,5 @@
 /*
-Copyright © 2022 - 2023 SUSE LLC
+Copyright © 2022 - 2026 SUSE LLC
 
 Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
@@ -15,178 +15,209 @@ limitations under the License.
 package e2e_test
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
-	"fmt"
-	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
 	"github.com/rancher-sandbox/ele-testhelpers/rancher"
 	"github.com/rancher-sandbox/ele-testhelpers/tools"
-	"gopkg.in/yaml.v3"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
 )
 
-const (
-	k3sInstallerFile    = "k3s-install.sh"
-	k3sInstallerVersion = "v1.36.2+k3s1"
-	k3sInstallerURL     = "https://raw.githubusercontent.com/k3s-io/k3s/" + k3sInstallerVersion + "/install.sh"
-	k3sInstallerSHA256  = "46177d4c99440b4c0311b67233823a8e8a2fc09693f6c89af1a7161e152fbfad"
-)
+/**
+ * Download the pinned K3s installer and verify its checksum
+ * @param path Where to save the installer
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func downloadK3sInstaller(path string) {
+	GinkgoWriter.Printf("Using K3s installer script version: %s\n", install.K3sInstallerVersion)
+	Expect(install.DownloadK3sInstaller(path)).To(Succeed())
+}
 
-func sha256File(filePath string) (string, error) {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
+/**
+ * Execute the K3s installer
+ * @param path Path of the installer
+ * @param env Extra installer variables, e.g. INSTALL_K3S_SKIP_DOWNLOAD=true
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func runK3sInstaller(path string, env ...string) {
+	out, err := install.RunK3sInstaller(path, env...)
+	GinkgoWriter.Printf("K3s installation output:\n%s\n", out)
+	Expect(err).ToNot(HaveOccurred())
+}
 
-	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
-		return "", err
+/**
+ * Patch the rancher-turtles entry of rancher-config to use the devel turtles image
+ * @param systemDefaultRegistry Registry the image is pulled from, empty for the image registry
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func patchRancherTurtlesConfig(systemDefaultRegistry string) {
+	Expect(controllerImage).To(Not(BeEmpty()), "CONTROLLER_IMG must be set when TURTLES_DEV_CHART=true")
+	patch, err := install.PatchTurtlesConfig(controllerImage, systemDefaultRegistry)
+	GinkgoWriter.Printf("%s\n", patch)
+	Expect(err).To(Not(HaveOccurred()))
+}
+
+func waitForResourceCondition(ns, resource, condition string) {
+	status, err := install.WaitForCondition(ns, resource, condition)
+	GinkgoWriter.Printf("kubectl wait %s/%s: %s", ns, resource, status)
+	Expect(err).To(Not(HaveOccurred()))
+}
+
+// waitForDeployments waits for the deployments to be Available
+func waitForDeployments(deployments []install.Deployment) {
+	for _, d := range deployments {
+		waitForResourceCondition(d.Namespace, "deployments/"+d.Name, "Available")
 	}
+}
 
-	return hex.EncodeToString(h.Sum(nil)), nil
+/**
+ * Get what the host must provide for an install mode
+ * @param mode Install mode, the chart server and CAPD settings are those of the suite
+ * @returns The host requirements
+ */
+func hostPreflight(mode install.PreflightMode) install.Preflight {
+	mode.DevTurtlesChart = turtlesDevChart
+	mode.ChartServerPort = os.Getenv("CHART_SERVER_PORT")
+	// CAPD clusters run in docker, on the kind network
+	mode.CAPD = slices.Contains(strings.Split(providersEnabled, ","), "infrastructureDocker")
+	p, err := install.NewPreflight(mode)
+	Expect(err).To(Not(HaveOccurred()))
+	return p
 }
 
-type RancherTurtlesConfig struct {
-	Global struct {
-		Cattle struct {
-			SystemDefaultRegistry string `yaml:"systemDefaultRegistry"`
-		} `yaml:"cattle"`
-	} `yaml:"global"`
-	Image struct {
-		Repository string `yaml:"repository"`
-	} `yaml:"image"`
-	// Preserve any other fields from existing data (e.g., features)
-	Extra map[string]interface{} `yaml:",inline"`
+/**
+ * Check the host provides what the install mode needs, before installing anything
+ * @param p Requirements of the install mode
+ * @returns Nothing, the function will fail through Ginkgo with every unmet requirement
+ */
+func checkHost(p install.Preflight) {
+	By("Checking the host", func() {
+		runPrecheckChecks(p.Checks())
+	})
 }
 
-func waitForResourceCondition(ns, resource, condition string) {
-	// Wait for resource to be created
-	status, err := kubectl.Run("wait", "--namespace", ns, "--for=create", resource, "--timeout=300s")
-	GinkgoWriter.Printf("kubectl wait --for=create %s/%s: %s", ns, resource, status)
-	Expect(err).To(Not(HaveOccurred()), "kubectl wait --for=create %s failed: %s", resource, status)
-
-	// Wait for the requested condition
-	status, err = kubectl.Run("wait", "--namespace", ns, "--for=condition="+condition, resource, "--timeout=300s")
-	GinkgoWriter.Printf("kubectl wait --for=condition=%s %s/%s: %s", condition, ns, resource, status)
-	Expect(err).To(Not(HaveOccurred()), "kubectl wait --for=condition=%s %s failed: %s", condition, resource, status)
+// installStateSettings returns the settings an install depends on, a resumed install must use the same
+func installStateSettings() install.StateSettings {
+	return install.StateSettings{
+		RancherVersion:        rancherVersion,
+		Hostname:              rancherHostname,
+		TLSMode:               rancherTLS.Mode,
+		TurtlesDevChart:       turtlesDevChart,
+		ControllerImage:       controllerImage,
+		SystemDefaultRegistry: airgapRegistry,
+		SystemChartOverrides:  os.Getenv("SYSTEM_CHART_OVERRIDES"),
+		ProxyURL:              os.Getenv("PROXY_URL"),
+	}
+}
+
+/**
+ * Run an install step unless it is found already done, see install.State.Run
+ * @param state Install state, nil to always run the step
+ * @param step Step name
+ * @param found Checks if the step is already done
+ * @param apply Does the step, the function will fail through Ginkgo in case of issue
+ * @returns true if the step was applied
+ */
+func runInstallStep(state *install.State, step string, found func() (bool, error), apply func()) bool {
+	applied, err := state.Run(step, found, func() error {
+		apply()
+		return nil
+	})
+	Expect(err).To(Not(HaveOccurred()))
+	if outcome := state.Outcome(step, applied); outcome != "" {
+		GinkgoWriter.Printf("%s\n", outcome)
+	}
+	return applied
 }
 
 var _ = Describe("E2E - Install/Upgrade Rancher Manager", Label("install", "upgrade"), func() {
-	It("Install/Upgrade Rancher Manager", func() {
+	It("Install/Upgrade Rancher Manager", Label("qase:748"), func() {
+		// Only the install pass is resumable, upgrades always deploy Rancher
+		var state *install.State
 		if Label("install").MatchesLabelFilter(GinkgoLabelFilter()) {
-			By("Installing K3s", func() {
-				// Get K3s installation script
-				Eventually(func() error {
-					return tools.GetFileFromURL(k3sInstallerURL, k3sInstallerFile, true)
-				}, tools.SetTimeout(2*time.Minute), 10*time.Second).ShouldNot(HaveOccurred())
-
-				// Verify installer integrity before execution
-				scriptSHA, err := sha256File(k3sInstallerFile)
+			By("Loading the install state", func() {
+				var err error
+				state, err = install.LoadState(installStateFile, installStateSettings().Config())
 				Expect(err).To(Not(HaveOccurred()))
-				hashMatches := scriptSHA == k3sInstallerSHA256
-				GinkgoWriter.Printf("Using K3s installer script version: %s\n", k3sInstallerVersion)
-				GinkgoWriter.Printf("K3s installer SHA256 expected=%s actual=%s match=%t\n", k3sInstallerSHA256, scriptSHA, hashMatches)
-				Expect(scriptSHA).To(Equal(k3sInstallerSHA256), "k3s installer checksum mismatch")
-
-				// Execute K3s installation
-				installCmd := exec.Command("sh", k3sInstallerFile)
-				installCmd.Env = append(os.Environ(), "INSTALL_K3S_EXEC=--disable metrics-server --write-kubeconfig-mode 0644", "INSTALL_K3S_SKIP_SELINUX_RPM=true")
-				out, err := installCmd.CombinedOutput()
-				GinkgoWriter.Printf("K3s installation output:\n%s\n", out)
-				Expect(err).ToNot(HaveOccurred())
+				GinkgoWriter.Printf("Install state %s, steps already done: %+v\n", installStateFile, state.Steps)
 			})
 
-			By("Starting K3s", func() {
-				err := exec.Command("sudo", "systemctl", "start", "k3s").Run()
-				Expect(err).To(Not(HaveOccurred()))
+			checkHost(hostPreflight(install.PreflightMode{}))
 
-				// Delay few seconds before checking
-				time.Sleep(tools.SetTimeout(20 * time.Second))
-			})
+			By("Installing K3s", func() {
+				found := func() (bool, error) { return install.K3sRunning(), nil }
+				applied := runInstallStep(state, install.StepK3s, found, func() {
+					downloadK3sInstaller(install.K3sInstallerFile)
+					runK3sInstaller(install.K3sInstallerFile)
+				})
 
-			By("Waiting for K3s resources", func() {
-				waitForResourceCondition("kube-system", "deployment/local-path-provisioner", "Available")
-				waitForResourceCondition("kube-system", "deployment/coredns", "Available")
-				waitForResourceCondition("kube-system", "deployment/traefik", "Available")
+				// Also sets KUBECONFIG when K3s is already running
+				Expect(install.StartK3s()).To(Succeed())
+				if applied {
+					// Delay few seconds before checking
+					time.Sleep(tools.SetTimeout(20 * time.Second))
+				}
 			})
 
-			By("Configuring Kubeconfig file", func() {
-				err := os.Setenv("KUBECONFIG", "/etc/rancher/k3s/k3s.yaml")
-				Expect(err).To(Not(HaveOccurred()))
+			By("Waiting for K3s resources", func() {
+				waitForDeployments(install.K3sDeployments)
 			})
 
 			By("Installing CertManager", func() {
-				RunHelmCmdWithRetry("repo", "add", "jetstack", "https://charts.jetstack.io")
-				RunHelmCmdWithRetry("repo", "update")
-
-				// Set flags for cert-manager installation
-				flags := []string{
-					"upgrade", "--install", "cert-manager", "jetstack/cert-manager",
-					"--namespace", "cert-manager",
-					"--create-namespace",
-					"--set", "crds.enabled=true",
-					"--wait", "--wait-for-jobs",
-				}
-
-				RunHelmCmdWithRetry(flags...)
-
-				waitForResourceCondition("cert-manager", "deployment/cert-manager", "Available")
+				runInstallStep(state, install.StepCertManager, install.CertManagerDeployed, func() {
+					out, err := install.InstallCertManager(install.CertManagerChart)
+					GinkgoWriter.Write([]byte(out))
+					Expect(err).To(Not(HaveOccurred()))
+				})
+				waitForDeployments([]install.Deployment{{Namespace: "cert-manager", Name: "cert-manager"}})
 			})
 		}
 
 		By("Installing/Upgrading Rancher Manager", func() {
 			// Used for providing artifical system chart during install/upgrade
 			var extraFlags []string = nil
-			if (isRancherManagerVersion(">=2.13")) && turtlesDevChart {
-				extraEnvIndex := 1
-				// For prime-alpha and prime-rc channels extraEnvIndex needs to be shifted
-				// Ref. https://github.com/rancher-sandbox/ele-testhelpers/blob/main/rancher/install.go#L93
-				if strings.Contains(rancherChannel, "prime-") {
-					extraEnvIndex = 2
-				}
-
-				rancherPointVersion := os.Getenv("RANCHER_POINT_VERSION")
-				entries := []struct {
-					name  string
-					value string
-				}{
-					{"CATTLE_CHART_DEFAULT_URL", "http://" + rancherHostname + ":4080" + "/git/charts"}, // Can we leave it hardcoded?
-					{"CATTLE_CHART_DEFAULT_BRANCH", "dev-v" + rancherPointVersion},
-					{"CATTLE_RANCHER_TURTLES_VERSION", "108.0.0+up99.99.99"}, // Ensure using custom built turtles
-				}
-
-				extraFlags = []string{}
-				for i, e := range entries {
-					idx := extraEnvIndex + i
-					extraFlags = append(extraFlags,
-						"--set", fmt.Sprintf("extraEnv[%d].name=%s", idx, e.name),
-						"--set-string", fmt.Sprintf("extraEnv[%d].value=%s", idx, e.value),
-					)
+			expectedChartVersions := map[string]string{}
+			if isRancherManagerVersion(">=2.13") {
+				systemCharts := newSystemChartsConfig()
+				if len(systemCharts.Env()) > 0 {
+					GinkgoWriter.Printf("System charts overrides: %+v\n", systemCharts.Env())
+					var err error
+					extraFlags, err = systemCharts.HelmFlags(filepath.Join(os.TempDir(), "rancher-system-charts"))
+					Expect(err).To(Not(HaveOccurred()))
+					for _, o := range systemCharts.Overrides {
+						expectedChartVersions[o.Chart] = o.Version
+					}
 				}
 			}
 
 			// Skip when upgrade
 			if Label("install").MatchesLabelFilter(GinkgoLabelFilter()) && isUpgradeTest {
 				extraFlags = nil
+				expectedChartVersions = map[string]string{}
 			}
 
+			// TLS mode flags are needed on upgrade too, helm would reset them otherwise
+			tlsFlags, err := rancherTLS.Prepare(rancherHostname)
+			Expect(err).To(Not(HaveOccurred()))
+			extraFlags = append(extraFlags, tlsFlags...)
+
 			// Overrides ele-testhelpers default behavior, put it as last to ensure it takes precedence over existing flags.
 			extraFlags = append(extraFlags, "--set", "useBundledSystemChart=false")
 
 			// Log the extra flags
 			GinkgoWriter.Write([]byte(strings.Join(extraFlags, " ") + "\n"))
 
-			err := rancher.DeployRancherManager(rancherHostname, rancherChannel, rancherVersion, rancherHeadVersion, "none", "none", extraFlags)
-			Expect(err).To(Not(HaveOccurred()))
+			// Skipped when Rancher is already at the target version, the next steps converge it
+			found := func() (bool, error) { return install.RancherDeployed(os.Getenv("RANCHER_VERSION")) }
+			runInstallStep(state, install.StepRancher, found, func() {
+				err := rancher.DeployRancherManager(rancherHostname, rancherChannel, rancherVersion, rancherHeadVersion, "none", "none", extraFlags)
+				Expect(err).To(Not(HaveOccurred()))
+			})
 
 			// Post-install/upgrade patching for dev build when rancher-turtles is installed as system-chart.
 			// Turtles chart in Rancher always uses [sdr/]rancher/turtles image regardless of what is written in chart's values.yaml.
@@ -202,52 +233,20 @@ var _ = Describe("E2E - Install/Upgrade Rancher Manager", Label("install", "upgr
 
 			if shouldPatch {
 				By("Patching rancher-config to use devel turtles image", func() {
-					Expect(controllerImage).To(Not(BeEmpty()), "CONTROLLER_IMG must be set when TURTLES_DEV_CHART=true")
-					_, err := kubectl.Run("wait", "--namespace", "cattle-system", "--for=create", "configmap/rancher-config", "--timeout=300s")
-					Expect(err).To(Not(HaveOccurred()))
-
-					// Parse existing YAML to preserve all fields (features, etc.)
-					config := &RancherTurtlesConfig{}
-					existingRancherTurtlesConfig, err := kubectl.Run("get", "configmap", "rancher-config", "-n", "cattle-system", "-o", "jsonpath={.data['rancher-turtles']}")
-					Expect(err).To(Not(HaveOccurred()))
-					if existingRancherTurtlesConfig != "" {
-						err := yaml.Unmarshal([]byte(existingRancherTurtlesConfig), config)
-						Expect(err).To(Not(HaveOccurred()))
-					}
-
-					// Update only the fields we control
-					config.Global.Cattle.SystemDefaultRegistry = ""
-					config.Image.Repository = controllerImage
-
-					// Make YAML from the updated config structure
-					combinedRancherTurtlesConfig, err := yaml.Marshal(config)
-					Expect(err).To(Not(HaveOccurred()))
-
-					patch := map[string]interface{}{
-						"data": map[string]string{
-							"rancher-turtles": string(combinedRancherTurtlesConfig),
-						},
-					}
-
-					// Make JSON for kubectl patch command (JSON with YAML string inside)
-					patchBytes, err := json.Marshal(patch)
-					Expect(err).To(Not(HaveOccurred()))
-
-					GinkgoWriter.Printf("%s\n", patchBytes)
-
-					status, err := kubectl.Run("patch", "configmap", "rancher-config", "-n", "cattle-system", "--type", "merge", "-p", string(patchBytes))
-					Expect(err).To(Not(HaveOccurred()))
-					Expect(status).To(ContainSubstring("patched"))
+					patchRancherTurtlesConfig(airgapRegistry)
 				})
 			}
 
 			By("Waiting for Rancher Manager resources", func() {
 				waitForResourceCondition("cattle-system", "deployments/rancher-webhook", "Available")
 				if isRancherManagerVersion(">=2.13") {
-					waitForResourceCondition("cattle-turtles-system", "deployments/rancher-turtles-controller-manager", "Available")
-					waitForResourceCondition("cattle-capi-system", "deployments/capi-controller-manager", "Available")
+					waitForDeployments(install.TurtlesDeployments)
 				}
 			})
+
+			By("Waiting for Rancher Manager to be usable", func() {
+				checkRancherReady(expectedChartVersions)
+			})
 		})
 	})
 })
@@ -0,0 +1,226 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	standaloneTurtlesNamespace = "rancher-turtles-system"
+	standaloneTurtlesRepo      = "https://rancher.github.io/turtles"
+	migrationClusterName       = "turtles-qa-migration"
+	migrationScript            = "../assets/migrate-providers-ownership.sh"
+)
+
+// migrationSnapshot records what existed before the migration, it is shared between the
+// pre-migration and post-migration passes through a state file
+type migrationSnapshot struct {
+	CRDs          []string `yaml:"crds"`
+	CAPIProviders []string `yaml:"capiProviders"`
+	CAPIClusters  []string `yaml:"capiClusters"`
+	V3Clusters    []string `yaml:"v3Clusters"`
+}
+
+/**
+ * List the CAPI and Turtles CRDs
+ * @returns Sorted list of CRD names
+ */
+func listCAPICRDs() []string {
+	crds, err := install.CAPICRDs()
+	Expect(err).To(Not(HaveOccurred()))
+	return crds
+}
+
+/**
+ * List the Rancher v3 clusters imported from CAPI clusters
+ * @returns Sorted list of v3 cluster names
+ */
+func listImportedV3Clusters() []string {
+	out, err := kubectl.Run("get", "clusters.management.cattle.io", "-l", capiClusterOwnerKey,
+		"-o", `jsonpath={range .items[*]}{.metadata.name}{"\n"}{end}`)
+	Expect(err).To(Not(HaveOccurred()), out)
+	return strings.Fields(out)
+}
+
+/**
+ * Find the deployments with a given name in all namespaces
+ * @param name Name of the deployment
+ * @returns List of "namespace/name" entries
+ */
+func findDeployments(name string) []string {
+	var found []string
+	for _, d := range listResources("deployments") {
+		if strings.HasSuffix(d, "/"+name) {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// nonCoreProviders drops the core CAPI provider, which moves to cattle-capi-system during the migration
+func nonCoreProviders(providers []string) []string {
+	var filtered []string
+	for _, p := range providers {
+		if !strings.HasSuffix(p, "/cluster-api") {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// migrationSnapshotFile returns the path of the state file shared between both passes
+func migrationSnapshotFile() string {
+	if migrationStateFile != "" {
+		return migrationStateFile
+	}
+	return filepath.Join(os.TempDir(), "turtles-migration-state.yaml")
+}
+
+var _ = Describe("E2E - Migrate standalone Turtles to system chart", Label("migration"), Ordered, func() {
+	// Migration is done in two passes around `make e2e-upgrade-rancher`:
+	// the pre-migration pass runs on Rancher < 2.13, the post-migration pass on Rancher >= 2.13
+	It("Pre-migration: install standalone Turtles chart and resources", func() {
+		if isRancherManagerVersion(">=2.13") {
+			Skip("Pre-migration pass requires Rancher < 2.13")
+		}
+
+		By("Installing the standalone rancher-turtles chart", func() {
+			RunHelmCmdWithRetry("repo", "add", "turtles", standaloneTurtlesRepo)
+			RunHelmCmdWithRetry("repo", "update")
+
+			flags := []string{
+				"upgrade", "--install", turtlesRelease, "turtles/rancher-turtles",
+				"--namespace", standaloneTurtlesNamespace,
+				"--create-namespace",
+				"--wait", "--wait-for-jobs",
+			}
+			if migrationTurtlesVersion != "" {
+				flags = append(flags, "--version", migrationTurtlesVersion)
+			}
+			RunHelmCmdWithRetry(flags...)
+
+			waitForResourceCondition(standaloneTurtlesNamespace, "deployments/"+turtlesControllerManager, "Available")
+			waitForCAPIProvidersReady([]string{"capi-system/cluster-api"})
+		})
+
+		By("Creating the Docker CAPIProvider", func() {
+			_, _ = kubectl.Run("create", "namespace", "capd-system")
+			kubectlApply(`apiVersion: turtles-capi.cattle.io/v1alpha1
+kind: CAPIProvider
+metadata:
+  name: docker
+  namespace: capd-system
+spec:
+  enableAutomaticUpdate: true
+  type: infrastructure
+  name: docker
+`)
+			waitForCAPIProvidersReady([]string{"capd-system/docker"})
+		})
+
+		By("Creating and importing a CAPI cluster", func() {
+			cluster := newFakeCAPICluster(migrationClusterName, fakeClusterNS)
+			cluster.Create()
+			cluster.WaitForImport()
+		})
+
+		By("Recording the pre-migration state", func() {
+			snapshot := migrationSnapshot{
+				CRDs:          listCAPICRDs(),
+				CAPIProviders: listResources(install.CAPIProvidersResource),
+				CAPIClusters:  listResources(capiClustersResource),
+				V3Clusters:    listImportedV3Clusters(),
+			}
+			data, err := yaml.Marshal(snapshot)
+			Expect(err).To(Not(HaveOccurred()))
+			GinkgoWriter.Printf("Pre-migration state:\n%s\n", data)
+			Expect(os.WriteFile(migrationSnapshotFile(), data, 0644)).To(Succeed())
+		})
+	})
+
+	It("Post-migration: check resources are preserved", func() {
+		if isRancherManagerVersion("<2.13") {
+			Skip("Post-migration pass requires Rancher >= 2.13")
+		}
+
+		snapshot := migrationSnapshot{}
+		By("Loading the pre-migration state", func() {
+			data, err := os.ReadFile(migrationSnapshotFile())
+			Expect(err).To(Not(HaveOccurred()), "Pre-migration state %s not found, was the pre-migration pass run?", migrationSnapshotFile())
+			Expect(yaml.Unmarshal(data, &snapshot)).To(Succeed())
+		})
+
+		By("Running the providers ownership migration script", func() {
+			// Without it the providers are not adopted, the checks below would not test a migration
+			_, err := os.Stat(migrationScript)
+			Expect(err).To(Not(HaveOccurred()), "Migration script %s not found, copy scripts/migrate-providers-ownership.sh of rancher/turtles there", migrationScript)
+
+			out, err := exec.Command(migrationScript, "--adopt", "docker:capd-system").CombinedOutput()
+			GinkgoWriter.Printf("Migration script output:\n%s\n", out)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		By("Checking Turtles runs as a system chart", func() {
+			waitForResourceCondition(turtlesNamespace, "deployments/"+turtlesControllerManager, "Available")
+			waitForResourceCondition(capiNamespace, "deployments/"+capiControllerManager, "Available")
+			waitForCAPIProvidersReady([]string{capiNamespace + "/cluster-api"})
+		})
+
+		By("Checking there are no duplicate controllers", func() {
+			release, err := install.HelmRelease(standaloneTurtlesNamespace, turtlesRelease)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(release.Deployed()).To(BeFalse(), "Standalone %s release is still deployed", turtlesRelease)
+			Expect(findDeployments(turtlesControllerManager)).To(ConsistOf(turtlesNamespace + "/" + turtlesControllerManager))
+			Expect(findDeployments(capiControllerManager)).To(ConsistOf(capiNamespace + "/" + capiControllerManager))
+		})
+
+		By("Checking CRDs are preserved", func() {
+			Expect(listCAPICRDs()).To(ContainElements(snapshot.CRDs))
+		})
+
+		By("Checking CAPIProviders are preserved", func() {
+			providers := nonCoreProviders(snapshot.CAPIProviders)
+			Expect(listResources(install.CAPIProvidersResource)).To(ContainElements(providers))
+			waitForCAPIProvidersReady(providers)
+		})
+
+		By("Checking CAPI clusters are preserved", func() {
+			Expect(listResources(capiClustersResource)).To(ContainElements(snapshot.CAPIClusters))
+		})
+
+		By("Checking imported v3 clusters are preserved", func() {
+			Expect(listImportedV3Clusters()).To(ContainElements(snapshot.V3Clusters))
+			for _, v3 := range snapshot.V3Clusters {
+				out, err := kubectl.Run("wait", "clusters.management.cattle.io/"+v3, "--for=condition=Ready", "--timeout=300s")
+				Expect(err).To(Not(HaveOccurred()), "Rancher v3 cluster %s is not Ready: %s", v3, out)
+			}
+		})
+
+		By("Deleting the migrated CAPI cluster", func() {
+			newFakeCAPICluster(migrationClusterName, fakeClusterNS).Delete()
+			Expect(os.Remove(migrationSnapshotFile())).To(Succeed())
+		})
+	})
+})
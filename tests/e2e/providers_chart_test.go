@@ -0,0 +1,317 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	providersChartName    = "rancher-turtles-providers"
+	providersChartRepo    = "rancher/charts/" + providersChartName
+	providersChartTimeout = "10m"
+)
+
+type chartProvider struct {
+	valuesKey string // key under .providers in the chart values
+	name      string // CAPIProvider name
+	namespace string // CAPIProvider and controller namespace
+}
+
+// providersChartProviders lists the providers the chart can enable
+func providersChartProviders() []chartProvider {
+	return []chartProvider{
+		{"bootstrapKubeadm", "kubeadm-bootstrap", "capi-kubeadm-bootstrap-system"},
+		{"controlplaneKubeadm", "kubeadm-control-plane", "capi-kubeadm-control-plane-system"},
+		{"bootstrapRKE2", "rke2-bootstrap", "rke2-bootstrap-system"},
+		{"controlplaneRKE2", "rke2-control-plane", "rke2-control-plane-system"},
+		{"infrastructureDocker", "docker", "capd-system"},
+		{"infrastructureAWS", "aws", "capa-system"},
+		{"infrastructureAzure", "azure", "capz-system"},
+		{"infrastructureGCP", "gcp", "capg-system"},
+		{"infrastructureVSphere", "vsphere", "capv-system"},
+	}
+}
+
+// matrixProviders maps the CAPIProvider names to the provider names of the compatibility matrix, i.e. of config-prime.yaml
+var matrixProviders = map[string]string{
+	"cluster-api":           "cluster-api",
+	"kubeadm-bootstrap":     "kubeadm",
+	"kubeadm-control-plane": "kubeadm",
+	"rke2-bootstrap":        "rke2",
+	"rke2-control-plane":    "rke2",
+	"aws":                   "aws",
+	"azure":                 "azure",
+	"gcp":                   "gcp",
+	"vsphere":               "vsphere",
+}
+
+/**
+ * Get the providers enabled through TURTLES_PROVIDERS_ENABLED
+ * @returns List of providers to enable in the chart
+ */
+func enabledChartProviders() []chartProvider {
+	var enabled []chartProvider
+	for _, key := range strings.Split(providersEnabled, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		found := false
+		for _, p := range providersChartProviders() {
+			if p.valuesKey == key {
+				enabled = append(enabled, p)
+				found = true
+				break
+			}
+		}
+		Expect(found).To(BeTrue(), "Unknown provider %q in TURTLES_PROVIDERS_ENABLED", key)
+	}
+	return enabled
+}
+
+/**
+ * Get the OCI reference of the providers chart
+ * @returns Chart reference, e.g. oci://registry.example.com/rancher/charts/rancher-turtles-providers
+ */
+func providersChartRef() string {
+	host := providersChartRegistry
+	if host == "" {
+		// Same logic as the Cypress tests: pre-release builds are only on the staging registry
+		host = primeRegistry
+		if strings.Contains(rancherVersion, "-rc") || strings.Contains(rancherVersion, "-alpha") || rancherChannel == "head" {
+			host = stgPrimeRegistry
+		}
+	}
+	Expect(host).To(Not(BeEmpty()), "No registry available for the providers chart, set TURTLES_PROVIDERS_CHART_REGISTRY")
+	return "oci://" + host + "/" + providersChartRepo
+}
+
+/**
+ * Install or upgrade the providers chart with the enabled providers
+ * @param version Version of the chart, empty for the latest one
+ * @param systemDefaultRegistry Registry the provider images are pulled from, empty for their own registries
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func installProvidersChart(version, systemDefaultRegistry string) {
+	flags := []string{
+		"upgrade", "--install", providersChartName, providersChartRef(),
+		"--namespace", turtlesNamespace,
+		"--wait", "--timeout", providersChartTimeout,
+	}
+	if version != "" {
+		flags = append(flags, "--version", version)
+	}
+	if providersChartPlainHTTP {
+		flags = append(flags, "--plain-http")
+	}
+	// Rancher sets it for the charts it installs, a plain helm install has to
+	if systemDefaultRegistry != "" {
+		flags = append(flags, "--set", "global.cattle.systemDefaultRegistry="+systemDefaultRegistry)
+	}
+	for _, p := range enabledChartProviders() {
+		flags = append(flags,
+			"--set", fmt.Sprintf("providers.%s.enabled=true", p.valuesKey),
+			"--set", fmt.Sprintf("providers.%s.enableAutomaticUpdate=true", p.valuesKey),
+		)
+	}
+
+	RunHelmCmdWithRetry(flags...)
+}
+
+/**
+ * Get the installed version of a CAPIProvider
+ * @param ns Namespace of the CAPIProvider
+ * @param name Name of the CAPIProvider
+ * @returns Installed version, empty if not yet installed
+ */
+func capiProviderInstalledVersion(ns, name string) string {
+	out, err := kubectl.Run("get", install.CAPIProvidersResource, name, "--namespace", ns, "-o", "jsonpath={.status.installedVersion}")
+	Expect(err).To(Not(HaveOccurred()), out)
+	return strings.TrimSpace(out)
+}
+
+/**
+ * Get the provider versions set by the installed providers chart, from the CAPIProviders of the release manifest
+ * @returns Versions by CAPIProvider name, providers left to their default version are not listed
+ */
+func chartProviderVersions() map[string]string {
+	out, err := kubectl.RunHelmBinaryWithOutput("get", "manifest", providersChartName, "--namespace", turtlesNamespace)
+	Expect(err).To(Not(HaveOccurred()), out)
+
+	versions := map[string]string{}
+	decoder := yaml.NewDecoder(strings.NewReader(out))
+	for {
+		var doc struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name string `yaml:"name"`
+			} `yaml:"metadata"`
+			Spec struct {
+				Version string `yaml:"version"`
+			} `yaml:"spec"`
+		}
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		Expect(err).To(Not(HaveOccurred()), "Invalid manifest in the %s release", providersChartName)
+		if doc.Kind == "CAPIProvider" && doc.Spec.Version != "" {
+			versions[doc.Metadata.Name] = doc.Spec.Version
+		}
+	}
+	return versions
+}
+
+// checkChartProviders waits for every enabled provider and its controllers, and returns their installed versions
+func checkChartProviders() map[string]string {
+	versions := map[string]string{}
+	for _, p := range enabledChartProviders() {
+		By(fmt.Sprintf("Checking provider %s/%s", p.namespace, p.name), func() {
+			waitForCAPIProvidersReady([]string{p.namespace + "/" + p.name})
+
+			out, err := kubectl.Run("wait", "deployment", "--all", "--namespace", p.namespace, "--for=condition=Available", "--timeout=300s")
+			GinkgoWriter.Printf("kubectl wait deployments in %s: %s", p.namespace, out)
+			Expect(err).To(Not(HaveOccurred()), "Controllers of %s are not Available", p.name)
+
+			Eventually(func() string {
+				return capiProviderInstalledVersion(p.namespace, p.name)
+			}, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(Not(BeEmpty()))
+			versions[p.name] = capiProviderInstalledVersion(p.namespace, p.name)
+			GinkgoWriter.Printf("Provider %s installed version: %s\n", p.name, versions[p.name])
+		})
+	}
+	return versions
+}
+
+var _ = Describe("E2E - Turtles providers chart", Label("providers"), Ordered, func() {
+	var installedVersions map[string]string
+
+	BeforeAll(func() {
+		if isRancherManagerVersion("<2.13") {
+			Skip(fmt.Sprintf("Skipping providers chart checks: requires Rancher >= 2.13 (version=%s)", rancherVersion))
+		}
+	})
+
+	It("Install providers chart", func() {
+		if len(providersChartArchives) > 0 {
+			By("Publishing providers chart archives to the registry", func() {
+				registry := strings.TrimSuffix(providersChartRef(), "/"+providersChartName)
+				for _, archive := range providersChartArchives {
+					flags := []string{"push", archive, registry}
+					if providersChartPlainHTTP {
+						flags = append(flags, "--plain-http")
+					}
+					RunHelmCmdWithRetry(flags...)
+				}
+			})
+		}
+
+		By("Installing the providers chart", func() {
+			GinkgoWriter.Printf("Installing %s %s with providers %q\n", providersChartRef(), providersChartVersion, providersEnabled)
+			installProvidersChart(providersChartVersion, "")
+		})
+
+		By("Checking the core CAPI provider", func() {
+			waitForCAPIProvidersReady([]string{capiNamespace + "/cluster-api"})
+		})
+
+		installedVersions = checkChartProviders()
+
+		// With an upgrade, the chart installed first is the one of an older Rancher minor
+		if providersChartUpgradeVersion == "" {
+			By("Checking the providers run the versions of the compatibility matrix", func() {
+				installed := map[string]string{"cluster-api": capiProviderInstalledVersion(capiNamespace, "cluster-api")}
+				for name, v := range installedVersions {
+					installed[name] = v
+				}
+
+				checked := 0
+				for name, v := range installed {
+					expected := compatibility.Providers[matrixProviders[name]]
+					if expected == "" {
+						continue
+					}
+					Expect(strings.TrimPrefix(v, "v")).To(Equal(strings.TrimPrefix(expected, "v")), "Provider %s does not run the version of the compatibility matrix", name)
+					checked++
+				}
+				Expect(checked).To(BeNumerically(">", 0), "No provider listed in the compatibility matrix")
+			})
+		}
+	})
+
+	It("Upgrade providers chart", func() {
+		if providersChartUpgradeVersion == "" {
+			Skip("Skipping providers chart upgrade: TURTLES_PROVIDERS_CHART_UPGRADE_VERSION not set")
+		}
+
+		By("Upgrading the providers chart", func() {
+			installProvidersChart(providersChartUpgradeVersion, "")
+		})
+
+		By("Waiting for the providers to roll forward to the chart versions", func() {
+			expectedVersions := chartProviderVersions()
+			GinkgoWriter.Printf("Provider versions of chart %s: %v\n", providersChartUpgradeVersion, expectedVersions)
+
+			checked := 0
+			for _, p := range enabledChartProviders() {
+				expected, found := expectedVersions[p.name]
+				if !found {
+					continue // left to its default version by the chart
+				}
+				checked++
+				// installedVersion still holds the previous version until the provider is reconciled
+				Eventually(func() string {
+					return strings.TrimPrefix(capiProviderInstalledVersion(p.namespace, p.name), "v")
+				}, tools.SetTimeout(10*time.Minute), 10*time.Second).Should(Equal(strings.TrimPrefix(expected, "v")),
+					"Provider %s/%s did not roll forward to %s", p.namespace, p.name, expected)
+			}
+			Expect(checked).To(BeNumerically(">", 0), "The providers chart %s sets the version of no enabled provider", providersChartUpgradeVersion)
+		})
+
+		upgradedVersions := checkChartProviders()
+
+		By("Checking provider versions rolled forward", func() {
+			upgraded := 0
+			for name, before := range installedVersions {
+				after := upgradedVersions[name]
+				GinkgoWriter.Printf("Provider %s: %s -> %s\n", name, before, after)
+
+				vBefore, err := semver.NewVersion(before)
+				Expect(err).To(Not(HaveOccurred()), "Invalid version %q for %s", before, name)
+				vAfter, err := semver.NewVersion(after)
+				Expect(err).To(Not(HaveOccurred()), "Invalid version %q for %s", after, name)
+				Expect(vAfter.LessThan(vBefore)).To(BeFalse(), "Provider %s was downgraded from %s to %s", name, before, after)
+				if vAfter.GreaterThan(vBefore) {
+					upgraded++
+				}
+			}
+			Expect(upgraded).To(BeNumerically(">", 0), "No provider version changed with the providers chart %s", providersChartUpgradeVersion)
+		})
+	})
+})
@@ -0,0 +1,175 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/rancher"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/proxy"
+)
+
+/**
+ * Write the hosts contacted through the proxy to the Ginkgo output and PROXY_REPORT_FILE
+ * @param server Proxy server
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func writeProxyReport(server *proxy.Server) {
+	var report bytes.Buffer
+	Expect(server.WriteReport(&report)).To(Succeed())
+	GinkgoWriter.Printf("Hosts contacted through the proxy:\n%s", report.String())
+
+	if file := os.Getenv("PROXY_REPORT_FILE"); file != "" {
+		Expect(os.WriteFile(file, report.Bytes(), 0o644)).To(Succeed())
+	}
+}
+
+// setProxyCAPIProviders sets the proxy of every CAPIProvider, they are reconciled with it
+func setProxyCAPIProviders(config install.ProxyConfig) []string {
+	providers, err := config.PatchCAPIProviders()
+	Expect(err).To(Not(HaveOccurred()))
+	return providers
+}
+
+var _ = Describe("E2E - Proxy Install Rancher Manager", Label("proxy-install"), func() {
+	BeforeEach(func() {
+		if isRancherManagerVersion("<2.13") {
+			Skip(fmt.Sprintf("Skipping proxy install: requires Rancher >= 2.13 (version=%s)", rancherVersion))
+		}
+	})
+
+	It("Install Rancher Manager and Turtles behind a proxy", func() {
+		var config install.ProxyConfig
+		installer := filepath.Join(os.TempDir(), install.K3sInstallerFile)
+		port := os.Getenv("PROXY_PORT")
+		if port == "" {
+			port = "3128"
+		}
+
+		proxyPort, err := strconv.Atoi(port)
+		Expect(err).To(Not(HaveOccurred()), "PROXY_PORT must be a port number")
+		checkHost(hostPreflight(install.PreflightMode{ProxyPort: proxyPort}))
+
+		By("Starting the proxy", func() {
+			server := proxy.New(":" + port)
+			Expect(server.Start()).To(Succeed())
+			// Registered first, so the report includes the traffic of the other cleanups
+			DeferCleanup(func() {
+				writeProxyReport(server)
+				Expect(server.Stop()).To(Succeed())
+			})
+
+			// Pods reach the proxy through the address of the host
+			host := os.Getenv("PROXY_HOST")
+			if host == "" {
+				var err error
+				host, err = proxy.OutboundIP()
+				Expect(err).To(Not(HaveOccurred()))
+			}
+			config = install.NewProxyConfig(server.URL(host), strings.FieldsFunc(os.Getenv("PROXY_NO_PROXY"), func(r rune) bool { return r == ',' })...)
+			GinkgoWriter.Printf("Proxy listening on %s, no proxy for %v\n", config.URL, config.NoProxy)
+
+			// helm and the other tools run by the suite go through the proxy too
+			for _, env := range config.Env() {
+				name, value, _ := strings.Cut(env, "=")
+				GinkgoT().Setenv(name, value)
+			}
+		})
+
+		By("Downloading the K3s installer", func() {
+			downloadK3sInstaller(installer)
+		})
+
+		By("Blocking direct outbound traffic", func() {
+			install.UnblockEgress()
+			// The proxy runs in this process, its user is exempted, which BlockEgress refuses for root
+			Expect(install.BlockEgress(os.Getuid())).To(Succeed(), "The proxy install must not run as root")
+			DeferCleanup(install.UnblockEgress)
+
+			// sudo resets the environment, so curl only uses the proxy when told to
+			curl := []string{"-u", "nobody", "curl", "-sS", "-o", "/dev/null", "--max-time", "30"}
+			Expect(install.RunSudo(append(curl, "https://github.com")...)).To(HaveOccurred(), "Outbound traffic is not blocked")
+			Expect(install.RunSudo(append(curl, "--proxy", config.URL, "https://github.com")...)).To(Succeed(), "Outbound traffic is blocked through the proxy")
+		})
+
+		By("Installing K3s with the proxy", func() {
+			// The installer writes the proxy variables to the K3s service environment
+			runK3sInstaller(installer, config.Env()...)
+			Expect(install.StartK3s()).To(Succeed())
+			waitForDeployments(install.K3sDeployments)
+		})
+
+		By("Installing CertManager", func() {
+			out, err := install.InstallCertManager(install.CertManagerChart)
+			GinkgoWriter.Write([]byte(out))
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		By("Installing Rancher Manager with the proxy", func() {
+			extraFlags := config.RancherHelmFlags()
+			tlsFlags, err := rancherTLS.Prepare(rancherHostname)
+			Expect(err).To(Not(HaveOccurred()))
+			extraFlags = append(extraFlags, tlsFlags...)
+			extraFlags = append(extraFlags, "--set", "useBundledSystemChart=false")
+
+			err = rancher.DeployRancherManager(rancherHostname, rancherChannel, rancherVersion, rancherHeadVersion, "none", "none", extraFlags)
+			Expect(err).To(Not(HaveOccurred()))
+
+			if turtlesDevChart {
+				patchRancherTurtlesConfig(airgapRegistry)
+			}
+			// Turtles downloads the provider manifests
+			patch, err := config.PatchTurtlesConfig()
+			GinkgoWriter.Printf("%s\n", patch)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		By("Setting the proxy of the Turtles and CAPI controllers", func() {
+			waitForResourceCondition("cattle-system", "deployments/rancher-webhook", "Available")
+			Eventually(func() error {
+				return config.CheckDeploymentEnv(turtlesNamespace, "rancher-turtles-controller-manager")
+			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(Succeed())
+			waitForDeployments(install.TurtlesDeployments)
+			setProxyCAPIProviders(config)
+		})
+
+		By("Waiting for Rancher Manager and the CAPIProviders", func() {
+			checkRancherReady(nil)
+			waitForCAPIProvidersReady(listResources(install.CAPIProvidersResource))
+		})
+
+		if providersChartRegistry == "" && primeRegistry == "" {
+			GinkgoWriter.Printf("No registry for the providers chart, only the core CAPI provider is checked\n")
+			return
+		}
+
+		By("Installing the providers chart", func() {
+			installProvidersChart(providersChartVersion, "")
+			waitForCAPIProvidersReady(setProxyCAPIProviders(config))
+		})
+
+		checkChartProviders()
+	})
+})
@@ -0,0 +1,179 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/rancherapi"
+)
+
+// Same names as the credentials created by the Cypress providers setup
+const (
+	awsCloudCredential     = "aws"
+	azureCloudCredential   = "azure"
+	gcpCloudCredential     = "gcp"
+	vsphereCloudCredential = "vsphere"
+)
+
+/**
+ * Get a Rancher API client logged in with RANCHER_USER/RANCHER_PASSWORD
+ * @returns Rancher API client
+ */
+func newRancherAPIClient() *rancherapi.Client {
+	client := rancherapi.New(rancherHostname, true)
+	Eventually(func() error {
+		return client.Login(rancherUser, rancherPassword)
+	}, tools.SetTimeout(2*time.Minute), 10*time.Second).Should(Succeed())
+	return client
+}
+
+/**
+ * Build the cloud credentials for the providers whose secrets are available, same env vars as Cypress
+ * @returns List of cloud credentials to create
+ */
+func cloudCredentialsFromEnv() []rancherapi.CloudCredential {
+	var creds []rancherapi.CloudCredential
+
+	if key, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); key != "" && secret != "" {
+		creds = append(creds, rancherapi.CloudCredential{
+			Name: awsCloudCredential,
+			AWS:  &rancherapi.AWSCredentialConfig{AccessKey: key, SecretKey: secret},
+		})
+	}
+
+	if id, secret := os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET"); id != "" && secret != "" {
+		creds = append(creds, rancherapi.CloudCredential{
+			Name: azureCloudCredential,
+			Azure: &rancherapi.AzureCredentialConfig{
+				ClientID:       id,
+				ClientSecret:   secret,
+				SubscriptionID: os.Getenv("AZURE_SUBSCRIPTION_ID"),
+				TenantID:       os.Getenv("AZURE_TENANT_ID"),
+			},
+		})
+	}
+
+	if gcp := os.Getenv("GCP_CREDENTIALS"); gcp != "" {
+		creds = append(creds, rancherapi.CloudCredential{
+			Name: gcpCloudCredential,
+			GCP:  &rancherapi.GCPCredentialConfig{AuthEncodedJSON: gcp},
+		})
+	}
+
+	if vsphere := os.Getenv("VSPHERE_SECRETS_JSON_BASE64"); vsphere != "" {
+		data, err := base64.StdEncoding.DecodeString(vsphere)
+		Expect(err).To(Not(HaveOccurred()), "Invalid VSPHERE_SECRETS_JSON_BASE64")
+		secrets := struct {
+			Username string `json:"vsphere_username"`
+			Password string `json:"vsphere_password"`
+			Server   string `json:"vsphere_server"`
+		}{}
+		Expect(json.Unmarshal(data, &secrets)).To(Succeed(), "Invalid VSPHERE_SECRETS_JSON_BASE64")
+		creds = append(creds, rancherapi.CloudCredential{
+			Name: vsphereCloudCredential,
+			VSphere: &rancherapi.VSphereCredentialConfig{
+				Username:    secrets.Username,
+				Password:    secrets.Password,
+				VCenter:     secrets.Server,
+				VCenterPort: "443",
+			},
+		})
+	}
+
+	return creds
+}
+
+var _ = Describe("E2E - Prepare Rancher through the API", Label("bootstrap"), Ordered, func() {
+	var client *rancherapi.Client
+
+	It("Bootstrap Rancher", func() {
+		Expect(rancherPassword).To(Not(BeEmpty()), "RANCHER_PASSWORD must be set")
+		// Only the admin user has a bootstrap password, do not retry for another one
+		Expect(rancherUser).To(Equal(rancherapi.DefaultUser), "RANCHER_USER must be "+rancherapi.DefaultUser+" to bootstrap Rancher")
+
+		By("Replacing the bootstrap password and accepting the terms", func() {
+			client = rancherapi.New(rancherHostname, true)
+			Eventually(func() error {
+				return client.Bootstrap(rancherUser, rancherBootstrapPassword, rancherPassword, "https://"+rancherHostname)
+			}, tools.SetTimeout(5*time.Minute), 10*time.Second).Should(Succeed())
+		})
+
+		By("Checking the new credentials", func() {
+			client = newRancherAPIClient()
+			url, err := client.GetSetting("server-url")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(url).To(Equal("https://" + rancherHostname))
+		})
+	})
+
+	It("Create an API token", func() {
+		token, err := client.CreateToken("turtles-e2e", "", 0)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(token.Token).To(Not(BeEmpty()))
+
+		By("Checking the token is accepted", func() {
+			_, err := client.WithToken(token.Token).GetSetting("server-version")
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		By("Checking a token scoped to the local cluster is accepted", func() {
+			scoped, err := client.CreateToken("turtles-e2e-local", "local", time.Hour)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(scoped.ClusterID).To(Equal("local"))
+			Expect(scoped.Token).To(Not(BeEmpty()))
+
+			_, err = client.WithToken(scoped.Token).GetSetting("server-version")
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(client.DeleteToken(scoped.ID)).To(Succeed())
+		})
+
+		// External tools can reuse it instead of logging in again
+		if rancherTokenFile != "" {
+			Expect(os.WriteFile(rancherTokenFile, []byte(token.Token), 0600)).To(Succeed())
+			GinkgoWriter.Printf("API token %s written to %s\n", token.ID, rancherTokenFile)
+		} else {
+			Expect(client.DeleteToken(token.ID)).To(Succeed())
+		}
+	})
+
+	It("Create cloud credentials", func() {
+		creds := cloudCredentialsFromEnv()
+		if len(creds) == 0 {
+			Skip("No cloud provider secret set")
+		}
+
+		for _, cred := range creds {
+			By("Creating cloud credential "+cred.Name, func() {
+				existing, err := client.FindCloudCredential(cred.Name)
+				Expect(err).To(Not(HaveOccurred()))
+				if existing != nil {
+					GinkgoWriter.Printf("Cloud credential %s already exists: %s\n", cred.Name, existing.ID)
+					return
+				}
+
+				created, err := client.CreateCloudCredential(cred)
+				Expect(err).To(Not(HaveOccurred()))
+				GinkgoWriter.Printf("Cloud credential %s created: %s\n", cred.Name, created.ID)
+			})
+		}
+	})
+})
@@ -0,0 +1,42 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+)
+
+const (
+	rancherReadyTimeout = 10 * time.Minute
+	rancherReadyPeriod  = 10 * time.Second
+)
+
+/**
+ * Check Rancher Manager is actually usable, not only Available
+ * @param expectedVersions Expected system chart versions by chart name, the other charts are checked against their Rancher setting
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func checkRancherReady(expectedVersions map[string]string) {
+	for _, c := range install.RancherReadinessChecks(rancherHostname, isRancherManagerVersion(">=2.13"), expectedVersions) {
+		By("Checking "+c.Name, func() {
+			Eventually(c.Run, tools.SetTimeout(rancherReadyTimeout), rancherReadyPeriod).Should(Succeed())
+		})
+	}
+}
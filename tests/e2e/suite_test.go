@@ -1,5 +1,5 @@
 /*
-Copyright © 2022 - 2023 SUSE LLC
+Copyright © 2022 - 2026 SUSE LLC
 
 Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
@@ -15,21 +15,22 @@ limitations under the License.
 package e2e_test
 
 import (
-	"fmt"
-	"io"
-	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
-	"time"
 
-	"github.com/Masterminds/semver/v3"
-	"github.com/google/go-containerregistry/pkg/authn"
-	"github.com/google/go-containerregistry/pkg/crane"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
-	"github.com/rancher-sandbox/ele-testhelpers/tools"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/chartserver"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/fetch"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/matrix"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/qase"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/rancherapi"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/registryauth"
 )
 
 var (
@@ -42,28 +43,49 @@ var (
 	rancherHeadVersion  string
 	rancherLogCollector string
 	rancherVersion      string
+	rancherTLS          install.RancherTLS
 	primeRegistry       string
 	stgPrimeRegistry    string
 	primeArtifactsURL   string
+	communityRegistry   string
+	airgapRegistry      string
+	registryAuth        *registryauth.Registries
+	sourceFetcher       *fetch.Fetcher
 	controllerImage     string
 	turtlesDevChart     bool
 	isUpgradeTest       bool
+
+	providersChartRegistry       string
+	providersChartVersion        string
+	providersChartUpgradeVersion string
+	providersChartArchives       []string
+	providersChartPlainHTTP      bool
+	providersEnabled             string
+
+	migrationTurtlesVersion string
+	migrationStateFile      string
+	installStateFile        string
+
+	rancherUser              string
+	rancherPassword          string
+	rancherBootstrapPassword string
+	rancherTokenFile         string
+
+	chartServer *chartserver.Server
+
+	compatibilityMatrix *matrix.Matrix
+	compatibility       matrix.Release // versions of the tested Rancher minor
 )
 
 /**
- * Execute RunHelmBinaryWithCustomErr within a loop with timeout
- * @param s options to pass to RunHelmBinaryWithCustomErr command
+ * Run a helm command with install.RunHelmWithRetry and print its output
+ * @param s Arguments of the helm command
  * @returns Nothing, the function will fail through Ginkgo in case of issue
  */
 func RunHelmCmdWithRetry(s ...string) {
-	Eventually(func() error {
-		output, err := kubectl.RunHelmBinaryWithOutput(s...)
-		GinkgoWriter.Write([]byte(output))
-		if err != nil {
-			return err
-		}
-		return nil
-	}, tools.SetTimeout(2*time.Minute), 20*time.Second).Should(Not(HaveOccurred()))
+	output, err := install.RunHelmWithRetry(s...)
+	GinkgoWriter.Write([]byte(output))
+	Expect(err).To(Not(HaveOccurred()))
 }
 
 /**
@@ -79,49 +101,79 @@ func isRancherManagerVersion(constraint string) bool {
 	// Better safe than sorry
 	Expect(rancherEnv).To(Not(BeEmpty()), "RANCHER_VERSION environment variable not set - test setup error")
 
-	// take everything after the last "/"
-	parts := strings.Split(rancherEnv, "/")
+	matches, err := install.RancherVersionMatches(rancherEnv, constraint)
+	Expect(err).To(Not(HaveOccurred()))
+	return matches
+}
 
-	// it is always last member of the array
-	rancherEnv = parts[len(parts)-1]
+/**
+ * Apply a YAML manifest with kubectl
+ * @param manifest YAML content to apply
+ * @param args extra arguments to pass to kubectl (e.g. "--kubeconfig", path)
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func kubectlApply(manifest string, args ...string) {
+	kubectlManifest("apply", manifest, args...)
+}
 
-	versionStr := strings.TrimSpace(rancherEnv)
-	Expect(versionStr).To(MatchRegexp(`^\d+\.\d+`), "Last part of RANCHER_VERSION does not contain a valid version (expected at least MAJOR.MINOR)")
+/**
+ * Delete the resources of a YAML manifest with kubectl, missing ones are ignored
+ * @param manifest YAML content to delete
+ * @param args extra arguments to pass to kubectl (e.g. "--kubeconfig", path)
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func kubectlDelete(manifest string, args ...string) {
+	kubectlManifest("delete", manifest, append([]string{"--ignore-not-found"}, args...)...)
+}
 
-	// Strip pre-release suffix "2.13.0-alpha8" or "2.13.0-rc1" -> "2.13.0"
-	if idx := strings.IndexAny(versionStr, "-"); idx != -1 {
-		versionStr = versionStr[:idx]
-	}
+func kubectlManifest(action, manifest string, args ...string) {
+	f, err := os.CreateTemp("", "manifest-*.yaml")
+	Expect(err).To(Not(HaveOccurred()))
+	defer os.Remove(f.Name())
 
-	// Coerce "2.13" -> "2.13.0"
-	if strings.Count(versionStr, ".") == 1 {
-		versionStr += ".0"
-	}
+	_, err = f.WriteString(manifest)
+	Expect(err).To(Not(HaveOccurred()))
+	Expect(f.Close()).To(Succeed())
 
-	v, _ := semver.NewVersion(versionStr)
-	c, _ := semver.NewConstraint(constraint)
+	out, err := kubectl.Run(append([]string{action, "-f", f.Name()}, args...)...)
+	GinkgoWriter.Printf("kubectl %s: %s\n", action, out)
+	Expect(err).To(Not(HaveOccurred()), "kubectl %s failed: %s", action, out)
+}
+
+/**
+ * List resources of a given type in all namespaces
+ * @param resource Resource type to list (e.g. clusters.cluster.x-k8s.io)
+ * @returns Sorted list of "namespace/name" entries
+ */
+func listResources(resource string) []string {
+	out, err := kubectl.Run("get", resource, "--all-namespaces", "--ignore-not-found",
+		"-o", `jsonpath={range .items[*]}{.metadata.namespace}/{.metadata.name}{"\n"}{end}`)
+	Expect(err).To(Not(HaveOccurred()), "Unable to list %s: %s", resource, out)
 
-	return c.Check(v)
+	items := strings.Fields(out)
+	sort.Strings(items)
+	return items
+}
+
+/**
+ * Wait for all the given CAPIProviders to be Ready
+ * @param providers List of "namespace/name" CAPIProvider entries
+ * @returns Nothing, the function will fail through Ginkgo in case of issue
+ */
+func waitForCAPIProvidersReady(providers []string) {
+	for _, p := range providers {
+		ns, name, found := strings.Cut(p, "/")
+		Expect(found).To(BeTrue(), "Invalid CAPIProvider entry %q", p)
+		waitForResourceCondition(ns, install.CAPIProvidersResource+"/"+name, "Ready")
+	}
 }
 
 func fetchBytes(url string) []byte {
-	resp, err := http.Get(url)
-	Expect(err).ToNot(HaveOccurred())
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	body, err := sourceFetcher.Get(url)
 	Expect(err).ToNot(HaveOccurred())
 	return body
 }
 
-func checkOCI(host, repo, tag string) {
-	Expect(tag).ToNot(BeEmpty(), "Version for %s/%s is empty - cannot check OCI registry", host, repo)
-	tag = strings.TrimSpace(tag)
-	ref := fmt.Sprintf("%s/%s:%s", host, repo, tag)
-	_, err := crane.Head(ref, crane.WithAuth(authn.Anonymous))
-	Expect(err).ToNot(HaveOccurred(), "Artifact not found: %s:%s", repo, tag)
-	GinkgoWriter.Printf("✅ Verified OCI: %s:%s\n", repo, tag)
-}
-
 func FailWithReport(message string, callerSkip ...int) {
 	// Ensures the correct line numbers are reported
 	Fail(message, callerSkip[0]+1)
@@ -145,21 +197,115 @@ var _ = BeforeSuite(func() {
 	primeRegistry = os.Getenv("PRIME_REGISTRY")
 	stgPrimeRegistry = os.Getenv("STG_PRIME_REGISTRY")
 	primeArtifactsURL = os.Getenv("PRIME_ARTIFACTS_URL")
+	communityRegistry = os.Getenv("COMMUNITY_REGISTRY")
+	if communityRegistry == "" {
+		communityRegistry = "docker.io"
+	}
+	airgapRegistry = os.Getenv("AIRGAP_REGISTRY")
+	// Source documents (build.yaml, clusterctl configs, image lists) are cached by ETag across runs
+	fetchCacheDir := os.Getenv("FETCH_CACHE_DIR")
+	if fetchCacheDir == "" {
+		fetchCacheDir = filepath.Join(os.TempDir(), "turtles-e2e-fetch-cache")
+	}
+	sourceFetcher = fetch.New(fetch.WithCacheDir(fetchCacheDir), fetch.WithGitHubToken(os.Getenv("GITHUB_TOKEN")))
+	var err error
+	registryAuth, err = registryauth.FromEnv()
+	Expect(err).To(Not(HaveOccurred()))
+	rancherTLS = install.RancherTLS{
+		Mode:                   os.Getenv("RANCHER_TLS_MODE"),
+		LetsEncryptEmail:       os.Getenv("RANCHER_TLS_LETSENCRYPT_EMAIL"),
+		LetsEncryptEnvironment: os.Getenv("RANCHER_TLS_LETSENCRYPT_ENVIRONMENT"),
+		Fetch:                  sourceFetcher.Get,
+	}
+	Expect(rancherTLS.Validate()).To(Succeed())
 	controllerImage = os.Getenv("CONTROLLER_IMG")
+	providersChartRegistry = os.Getenv("TURTLES_PROVIDERS_CHART_REGISTRY")
+	providersChartVersion = os.Getenv("TURTLES_PROVIDERS_CHART_VERSION")
+	providersChartUpgradeVersion = os.Getenv("TURTLES_PROVIDERS_CHART_UPGRADE_VERSION")
+	providersChartArchives = strings.Fields(os.Getenv("TURTLES_PROVIDERS_CHART_ARCHIVES"))
+	providersChartPlainHTTP = os.Getenv("TURTLES_PROVIDERS_CHART_PLAIN_HTTP") == "true"
+	providersEnabled = os.Getenv("TURTLES_PROVIDERS_ENABLED")
+	migrationTurtlesVersion = os.Getenv("MIGRATION_TURTLES_VERSION")
+	migrationStateFile = os.Getenv("MIGRATION_STATE_FILE")
+	installStateFile = os.Getenv("INSTALL_STATE_FILE")
+	if installStateFile == "" {
+		installStateFile = install.DefaultStateFile
+	}
+	if providersEnabled == "" {
+		providersEnabled = "bootstrapKubeadm,controlplaneKubeadm,infrastructureDocker"
+	}
+	rancherUser = os.Getenv("RANCHER_USER")
+	if rancherUser == "" {
+		rancherUser = rancherapi.DefaultUser
+	}
+	rancherPassword = os.Getenv("RANCHER_PASSWORD")
+	rancherBootstrapPassword = os.Getenv("RANCHER_BOOTSTRAP_PASSWORD")
+	if rancherBootstrapPassword == "" {
+		rancherBootstrapPassword = rancherapi.DefaultBootstrapPassword
+	}
+	rancherTokenFile = os.Getenv("RANCHER_TOKEN_FILE")
+
+	// Load the version compatibility matrix, shared with Cypress
+	matrixFile := os.Getenv("COMPATIBILITY_MATRIX")
+	if matrixFile == "" {
+		matrixFile = "../assets/compatibility-matrix.yaml"
+	}
+	compatibilityMatrix, err = matrix.Load(matrixFile)
+	Expect(err).To(Not(HaveOccurred()))
+	// The Rancher version is the last part of RANCHER_VERSION, minors not listed use the default entry
+	rancherParts := strings.Split(rancherVersion, "/")
+	compatibilityKey, release, err := compatibilityMatrix.Release(rancherParts[len(rancherParts)-1])
+	Expect(err).To(Not(HaveOccurred()))
+	compatibility = release
+	GinkgoWriter.Printf("Using the %s entry of the compatibility matrix\n", compatibilityKey)
+
+	// Start the local chart server if requested, unless the chart-server service already serves it
+	if port := os.Getenv("CHART_SERVER_PORT"); port != "" {
+		if chartserver.Serving("localhost:" + port) {
+			GinkgoWriter.Printf("Chart server already listening on port %s\n", port)
+		} else {
+			chartServer = chartserver.New(":"+port, os.Getenv("CHART_SERVER_GIT_ROOT"))
+			patterns := strings.Fields(os.Getenv("CHART_SERVER_CHARTS"))
+			if len(patterns) == 0 {
+				patterns = []string{"../assets/rancher-turtles-*.tgz", "../assets/providers/rancher-turtles-providers-*.tgz"}
+			}
+			published, err := chartServer.PublishGlob(patterns...)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(chartServer.Start()).To(Succeed())
+			GinkgoWriter.Printf("Chart server listening on %s, published charts: %v\n", chartServer.Host(), published)
+		}
+	}
 
 	// Extract Rancher Manager channel/version to install
 	if rancherVersion != "" {
-		// Split rancherVersion and reset it
-		s := strings.Split(rancherVersion, "/")
-		rancherVersion = ""
-
-		// Get needed informations
-		rancherChannel = s[0]
-		if len(s) > 1 {
-			rancherVersion = s[1]
-		}
-		if len(s) > 2 {
-			rancherHeadVersion = s[2]
-		}
+		rancherChannel, rancherVersion, rancherHeadVersion = install.ParseRancherVersion(rancherVersion)
+	}
+})
+
+var _ = AfterSuite(func() {
+	if file := os.Getenv("FETCH_PROVENANCE_FILE"); file != "" && len(sourceFetcher.Provenance()) > 0 {
+		Expect(sourceFetcher.WriteProvenance(file)).To(Succeed())
+		GinkgoWriter.Printf("Provenance of %d source documents written to %s\n", len(sourceFetcher.Provenance()), file)
+	}
+	if chartServer != nil {
+		Expect(chartServer.Stop()).To(Succeed())
+	}
+})
+
+// Report the results to Qase when QASE_MODE is testops, in the run shared with Cypress
+var _ = ReportAfterSuite("Qase", func(report Report) {
+	config, err := qase.ConfigFromEnv()
+	Expect(err).To(Not(HaveOccurred()))
+	if !config.Enabled() {
+		return
+	}
+
+	runID, count, err := qase.NewReporter(config).Report(report)
+	if count > 0 {
+		GinkgoWriter.Printf("%d results reported to Qase run %d\n", count, runID)
+	}
+	// An unavailable Qase must not fail the tests
+	if err != nil {
+		GinkgoWriter.Printf("Unable to report to Qase: %v\n", err)
 	}
 })
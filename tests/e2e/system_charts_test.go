@@ -0,0 +1,48 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"os"
+
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/install"
+)
+
+/**
+ * Build the system charts configuration from the environment
+ * SYSTEM_CHARTS_REPO_URL, SYSTEM_CHARTS_BRANCH and SYSTEM_CHART_OVERRIDES (chart=version,...) override the defaults
+ * @returns System charts configuration
+ */
+func newSystemChartsConfig() install.SystemChartsConfig {
+	config := install.SystemChartsConfig{
+		RepoURL: os.Getenv("SYSTEM_CHARTS_REPO_URL"),
+		Branch:  os.Getenv("SYSTEM_CHARTS_BRANCH"),
+	}
+
+	if turtlesDevChart {
+		// The chart server started with `turtles-e2e chart-server` serves the system charts repo when it has a git root
+		port := install.DevSystemChartsGitPort(os.Getenv("CHART_SERVER_PORT"), os.Getenv("CHART_SERVER_GIT_ROOT"))
+		config.UseDevTurtles(rancherHostname, port, os.Getenv("RANCHER_POINT_VERSION"), os.Getenv("TURTLES_CHART_DEV_VERSION"))
+	}
+
+	overrides, err := install.ParseSystemChartOverrides(os.Getenv("SYSTEM_CHART_OVERRIDES"))
+	Expect(err).To(Not(HaveOccurred()), "Invalid SYSTEM_CHART_OVERRIDES")
+	for _, o := range overrides {
+		config.Set(o)
+	}
+
+	return config
+}
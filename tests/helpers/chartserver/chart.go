@@ -0,0 +1,172 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Media types used by Helm for charts stored in OCI registries
+const (
+	helmConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+	helmChartMediaType  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// indexEntry is a chart version in the Helm index, i.e. its Chart.yaml plus repository fields
+type indexEntry map[string]interface{}
+
+func newIndexEntry(metadata map[string]interface{}, archive []byte, url string) indexEntry {
+	entry := indexEntry{}
+	for k, v := range metadata {
+		entry[k] = v
+	}
+	sum := sha256.Sum256(archive)
+	entry["digest"] = hex.EncodeToString(sum[:])
+	entry["urls"] = []string{url}
+	entry["created"] = time.Now().UTC().Format(time.RFC3339)
+	return entry
+}
+
+// chartMetadata reads <chart>/Chart.yaml from a chart archive
+func chartMetadata(archive []byte) (map[string]interface{}, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("Chart.yaml not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parts := strings.Split(strings.TrimPrefix(h.Name, "./"), "/")
+		if len(parts) != 2 || parts[1] != "Chart.yaml" {
+			continue
+		}
+
+		metadata := map[string]interface{}{}
+		if err := yaml.NewDecoder(tr).Decode(&metadata); err != nil {
+			return nil, err
+		}
+		return metadata, nil
+	}
+}
+
+// rawManifest is an OCI manifest pushed as is
+type rawManifest []byte
+
+func (m rawManifest) RawManifest() ([]byte, error)        { return m, nil }
+func (m rawManifest) MediaType() (types.MediaType, error) { return types.OCIManifestSchema1, nil }
+
+// registryHost is the registry charts are pushed to, any host reaches the embedded registry through registryTransport
+const registryHost = "localhost"
+
+// registryTransport sends the requests to the embedded registry, without going through the network
+type registryTransport struct {
+	registry http.Handler
+}
+
+func (t registryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Handlers expect a body, client requests may have none
+	served := req.Clone(req.Context())
+	if served.Body == nil {
+		served.Body = http.NoBody
+	}
+	rec := httptest.NewRecorder()
+	t.registry.ServeHTTP(rec, served)
+	resp := rec.Result()
+	// Upload locations are resolved against the request URL
+	resp.Request = req
+	return resp, nil
+}
+
+// pushOCI pushes a chart to the embedded registry the same way `helm push` does
+func (s *Server) pushOCI(chartName, version string, metadata map[string]interface{}, archive []byte) error {
+	transport := remote.WithTransport(registryTransport{s.registry})
+
+	// OCI tags do not allow '+', Helm replaces it with '_'
+	ref, err := name.ParseReference(registryHost+"/"+ChartsRepo+"/"+chartName+":"+strings.ReplaceAll(version, "+", "_"), name.Insecure)
+	if err != nil {
+		return err
+	}
+
+	config, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	configLayer := static.NewLayer(config, helmConfigMediaType)
+	chartLayer := static.NewLayer(archive, helmChartMediaType)
+
+	manifest := v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+	}
+	for i, l := range []v1.Layer{configLayer, chartLayer} {
+		if err := remote.WriteLayer(ref.Context(), l, transport); err != nil {
+			return err
+		}
+
+		digest, err := l.Digest()
+		if err != nil {
+			return err
+		}
+		size, err := l.Size()
+		if err != nil {
+			return err
+		}
+		mediaType, err := l.MediaType()
+		if err != nil {
+			return err
+		}
+
+		desc := v1.Descriptor{MediaType: mediaType, Size: size, Digest: digest}
+		if i == 0 {
+			manifest.Config = desc
+		} else {
+			manifest.Layers = append(manifest.Layers, desc)
+		}
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return remote.Put(ref, rawManifest(body), transport)
+}
@@ -0,0 +1,244 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package chartserver serves Helm charts the way Rancher and the e2e tests consume them:
+// a Helm HTTP repository (chartmuseum layout), an OCI registry and git repositories over
+// smart HTTP, all on a single port and without any external service.
+package chartserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ChartsRepo is the OCI repository prefix charts are published under
+	ChartsRepo = "rancher/charts"
+
+	gitPrefix    = "/git"
+	chartsPrefix = "/charts/"
+)
+
+// Server is a chart server, create it with New
+type Server struct {
+	addr     string
+	gitRoot  string
+	listener net.Listener
+	srv      *http.Server
+	registry http.Handler
+
+	mu     sync.RWMutex
+	charts map[string][]indexEntry // Helm index entries by chart name
+	files  map[string]string       // chart archive path by file name
+}
+
+// New creates a chart server listening on addr (e.g. ":8080").
+// When gitRoot is not empty, the git repositories below it are served under /git/.
+func New(addr, gitRoot string) *Server {
+	return &Server{
+		addr:     addr,
+		gitRoot:  gitRoot,
+		registry: registry.New(registry.Logger(log.New(io.Discard, "", 0))),
+		charts:   map[string][]indexEntry{},
+		files:    map[string]string{},
+	}
+}
+
+// Handler returns the handler of the Helm repository, the OCI registry and the git repositories
+func (s *Server) Handler() (http.Handler, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.yaml", s.serveIndex)
+	mux.HandleFunc(chartsPrefix, s.serveChart)
+	mux.Handle("/v2/", s.registry)
+
+	if s.gitRoot != "" {
+		gitHandler, err := s.gitHandler()
+		if err != nil {
+			return nil, err
+		}
+		mux.Handle(gitPrefix+"/", gitHandler)
+	}
+	return mux, nil
+}
+
+// Start starts serving in the background
+func (s *Server) Start() error {
+	handler, err := s.Handler()
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.addr, err)
+	}
+	s.listener = l
+	s.srv = &http.Server{Handler: handler, ReadHeaderTimeout: 30 * time.Second}
+
+	go func() {
+		if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("chart server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops the server
+func (s *Server) Stop() error {
+	if s.srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+// Host returns the local host:port the server listens on
+func (s *Server) Host() string {
+	if s.listener == nil {
+		return s.addr
+	}
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return "localhost:" + port
+}
+
+// Serving returns true if a chart server already answers on host, e.g. the chart-server service
+func Serving(host string) bool {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + host + "/index.yaml")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Publish adds a chart archive to the Helm repository and pushes it to the OCI registry
+// as <host>/rancher/charts/<name>:<version>, it may be called before Start
+func (s *Server) Publish(archive string) error {
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := chartMetadata(data)
+	if err != nil {
+		return fmt.Errorf("reading chart metadata from %s: %w", archive, err)
+	}
+	name, _ := metadata["name"].(string)
+	version, _ := metadata["version"].(string)
+	if name == "" || version == "" {
+		return fmt.Errorf("chart %s has no name or version", archive)
+	}
+
+	file := filepath.Base(archive)
+	s.mu.Lock()
+	s.files[file] = archive
+	s.charts[name] = append(s.charts[name], newIndexEntry(metadata, data, chartsPrefix[1:]+file))
+	s.mu.Unlock()
+
+	if err := s.pushOCI(name, version, metadata, data); err != nil {
+		return fmt.Errorf("pushing %s to the OCI registry: %w", archive, err)
+	}
+	return nil
+}
+
+// PublishGlob publishes all the chart archives matching the given patterns
+func (s *Server) PublishGlob(patterns ...string) ([]string, error) {
+	var published []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return published, err
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if err := s.Publish(m); err != nil {
+				return published, err
+			}
+			published = append(published, m)
+		}
+	}
+	return published, nil
+}
+
+func (s *Server) serveChart(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	archive, found := s.files[strings.TrimPrefix(r.URL.Path, chartsPrefix)]
+	s.mu.RUnlock()
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, archive)
+}
+
+func (s *Server) gitHandler() (http.Handler, error) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return nil, fmt.Errorf("git is required to serve %s: %w", s.gitRoot, err)
+	}
+	root, err := filepath.Abs(s.gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cgi.Handler{
+		Path: git,
+		Args: []string{"http-backend"},
+		Root: gitPrefix,
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + root,
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	}, nil
+}
+
+// index returns the Helm repository index
+func (s *Server) index() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"entries":    s.charts,
+		"generated":  time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, _ *http.Request) {
+	data, err := s.index()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	_, _ = w.Write(data)
+}
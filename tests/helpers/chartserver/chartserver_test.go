@@ -0,0 +1,187 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartserver_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/chartserver"
+	"gopkg.in/yaml.v3"
+)
+
+// writeChart writes a chart archive named <name>-<version>.tgz to dir, as `helm package` does
+func writeChart(dir, chartName, version string) string {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for file, content := range map[string]string{
+		"Chart.yaml":               "apiVersion: v2\nname: " + chartName + "\nversion: " + version + "\nappVersion: v0.25.0\n",
+		"templates/configmap.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + chartName + "\n",
+	} {
+		Expect(tw.WriteHeader(&tar.Header{Name: chartName + "/" + file, Mode: 0o644, Size: int64(len(content))})).To(Succeed())
+		_, err := tw.Write([]byte(content))
+		Expect(err).To(Not(HaveOccurred()))
+	}
+	Expect(tw.Close()).To(Succeed())
+	Expect(gw.Close()).To(Succeed())
+
+	archive := filepath.Join(dir, chartName+"-"+version+".tgz")
+	Expect(os.WriteFile(archive, buf.Bytes(), 0o644)).To(Succeed())
+	return archive
+}
+
+func get(url string) (int, []byte) {
+	resp, err := http.Get(url)
+	Expect(err).To(Not(HaveOccurred()))
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	Expect(err).To(Not(HaveOccurred()))
+	return resp.StatusCode, body
+}
+
+func git(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	Expect(err).To(Not(HaveOccurred()), string(out))
+	return strings.TrimSpace(string(out))
+}
+
+// index is the part of a Helm index the tests check
+type index struct {
+	Entries map[string][]struct {
+		Version string   `yaml:"version"`
+		Digest  string   `yaml:"digest"`
+		URLs    []string `yaml:"urls"`
+	} `yaml:"entries"`
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+var _ = Describe("Chart server", func() {
+	var (
+		dir     string
+		turtles string
+		server  *chartserver.Server
+		web     *httptest.Server
+	)
+
+	// serve publishes the charts and serves them, as `turtles-e2e chart-server` does
+	serve := func(gitRoot string, archives ...string) {
+		server = chartserver.New("", gitRoot)
+		for _, archive := range archives {
+			Expect(server.Publish(archive)).To(Succeed())
+		}
+		handler, err := server.Handler()
+		Expect(err).To(Not(HaveOccurred()))
+		web = httptest.NewServer(handler)
+		DeferCleanup(web.Close)
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		turtles = writeChart(dir, "rancher-turtles", "0.25.0")
+	})
+
+	It("serves the charts as a Helm repository", func() {
+		providers := writeChart(dir, "rancher-turtles-providers", "0.25.0+build.1")
+		serve("", turtles, providers)
+
+		status, body := get(web.URL + "/index.yaml")
+		Expect(status).To(Equal(http.StatusOK))
+		var idx index
+		Expect(yaml.Unmarshal(body, &idx)).To(Succeed())
+		Expect(idx.Entries).To(HaveLen(2))
+		Expect(idx.Entries["rancher-turtles-providers"]).To(HaveLen(1))
+		entry := idx.Entries["rancher-turtles-providers"][0]
+		Expect(entry.Version).To(Equal("0.25.0+build.1"))
+		Expect(entry.URLs).To(Equal([]string{"charts/rancher-turtles-providers-0.25.0+build.1.tgz"}))
+
+		data, err := os.ReadFile(providers)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(entry.Digest).To(Equal(sha256Hex(data)))
+		status, body = get(web.URL + "/" + entry.URLs[0])
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(Equal(data))
+
+		status, _ = get(web.URL + "/charts/fleet-0.14.0.tgz")
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("pushes the charts to the OCI registry as helm push does", func() {
+		providers := writeChart(dir, "rancher-turtles-providers", "0.25.0+build.1")
+		serve("", providers)
+
+		// OCI tags do not allow '+'
+		host := strings.TrimPrefix(web.URL, "http://")
+		ref, err := name.ParseReference(host+"/"+chartserver.ChartsRepo+"/rancher-turtles-providers:0.25.0_build.1", name.Insecure)
+		Expect(err).To(Not(HaveOccurred()))
+		desc, err := remote.Get(ref)
+		Expect(err).To(Not(HaveOccurred()))
+		manifest, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(manifest.Config.MediaType)).To(Equal("application/vnd.cncf.helm.config.v1+json"))
+		Expect(manifest.Layers).To(HaveLen(1))
+		Expect(string(manifest.Layers[0].MediaType)).To(Equal("application/vnd.cncf.helm.chart.content.v1.tar+gzip"))
+
+		data, err := os.ReadFile(providers)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(manifest.Layers[0].Digest.Hex).To(Equal(sha256Hex(data)))
+		layer, err := remote.Layer(ref.Context().Digest(manifest.Layers[0].Digest.String()))
+		Expect(err).To(Not(HaveOccurred()))
+		rc, err := layer.Compressed()
+		Expect(err).To(Not(HaveOccurred()))
+		defer rc.Close()
+		Expect(io.ReadAll(rc)).To(Equal(data))
+	})
+
+	It("serves the git repositories of its git root", func() {
+		// The system charts repo, as scripts/build-local-rancher-charts.sh of rancher/turtles builds it
+		repo := filepath.Join(dir, "git", "charts")
+		Expect(os.MkdirAll(repo, 0o755)).To(Succeed())
+		git(repo, "init", "--initial-branch", "dev-v2.14")
+		Expect(os.WriteFile(filepath.Join(repo, "index.yaml"), []byte("apiVersion: v1\nentries: {}\n"), 0o644)).To(Succeed())
+		git(repo, "add", "index.yaml")
+		git(repo, "-c", "user.name=e2e", "-c", "user.email=e2e@localhost", "commit", "-m", "Add index")
+
+		serve(filepath.Join(dir, "git"))
+		Expect(chartserver.Serving(strings.TrimPrefix(web.URL, "http://"))).To(BeTrue())
+		clone := filepath.Join(dir, "clone")
+		git(dir, "clone", "--branch", "dev-v2.14", web.URL+"/git/charts", clone)
+		Expect(filepath.Join(clone, "index.yaml")).To(BeAnExistingFile())
+
+		status, _ := get(web.URL + "/git/fleet/info/refs?service=git-upload-pack")
+		Expect(status).To(Not(Equal(http.StatusOK)))
+	})
+})
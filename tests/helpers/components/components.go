@@ -0,0 +1,216 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package components reads CAPI provider component manifests published as OCI artifacts,
+// e.g. <registry>/rancher/cluster-api-aws-controller-components:<version>.
+package components
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"gopkg.in/yaml.v3"
+)
+
+// titleAnnotation holds the file name of a layer pushed by oras
+const titleAnnotation = "org.opencontainers.image.title"
+
+// File is a file of a component artifact
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Object is a Kubernetes object of a component manifest
+type Object struct {
+	File       string
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+	Images     []string
+}
+
+// String returns a readable reference of the object
+func (o Object) String() string {
+	name := o.Name
+	if o.Namespace != "" {
+		name = o.Namespace + "/" + name
+	}
+	return fmt.Sprintf("%s %s (%s)", o.Kind, name, o.File)
+}
+
+// PullReference downloads the files of a component artifact, the reference may be parsed with name.Insecure
+func PullReference(r name.Reference, opts ...remote.Option) ([]File, error) {
+	ref := r.String()
+	desc, err := remote.Get(r, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", ref, err)
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s manifest: %w", ref, err)
+	}
+
+	var files []File
+	for _, l := range manifest.Layers {
+		layer, err := remote.Layer(r.Context().Digest(l.Digest.String()), opts...)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("fetching %s layer %s: %w", ref, l.Digest, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		// oras pushes files as is and directories as tarballs
+		if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+			extracted, err := untar(data)
+			if err != nil {
+				return nil, fmt.Errorf("extracting %s layer %s: %w", ref, l.Digest, err)
+			}
+			files = append(files, extracted...)
+			continue
+		}
+		fileName := l.Annotations[titleAnnotation]
+		if fileName == "" {
+			fileName = l.Digest.String()
+		}
+		files = append(files, File{Name: fileName, Data: data})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func untar(data []byte) ([]File, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var files []File
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: h.Name, Data: content})
+	}
+}
+
+// IsManifest tells if a file holds Kubernetes objects, metadata.yaml only describes the release
+func IsManifest(f File) bool {
+	ext := path.Ext(f.Name)
+	return (ext == ".yaml" || ext == ".yml") && path.Base(f.Name) != "metadata.yaml"
+}
+
+// Parse reads the Kubernetes objects of a manifest file and checks each of them has an
+// apiVersion, a kind and a name
+func Parse(f File) ([]Object, error) {
+	var objects []Object
+	var errs []error
+
+	dec := yaml.NewDecoder(bytes.NewReader(f.Data))
+	for i := 0; ; i++ {
+		var doc map[string]interface{}
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return objects, fmt.Errorf("%s: document %d: %w", f.Name, i, err)
+		}
+		if len(doc) == 0 {
+			continue
+		}
+
+		o := Object{File: f.Name}
+		o.APIVersion, _ = doc["apiVersion"].(string)
+		o.Kind, _ = doc["kind"].(string)
+		if metadata, ok := doc["metadata"].(map[string]interface{}); ok {
+			o.Name, _ = metadata["name"].(string)
+			o.Namespace, _ = metadata["namespace"].(string)
+		}
+		if o.APIVersion == "" || o.Kind == "" || o.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: document %d is not a valid Kubernetes object (apiVersion=%q kind=%q name=%q)", f.Name, i, o.APIVersion, o.Kind, o.Name))
+			continue
+		}
+		o.Images = findImages(doc)
+		objects = append(objects, o)
+	}
+	return objects, errors.Join(errs...)
+}
+
+// findImages returns the values of all the image fields of an object, e.g. in containers and initContainers
+func findImages(node interface{}) []string {
+	var images []string
+	switch n := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if image, ok := n[k].(string); ok && k == "image" {
+				images = append(images, image)
+				continue
+			}
+			images = append(images, findImages(n[k])...)
+		}
+	case []interface{}:
+		for _, v := range n {
+			images = append(images, findImages(v)...)
+		}
+	}
+	return images
+}
+
+// StripRegistry removes the registry of an image reference, e.g.
+// registry.k8s.io/cluster-api/cluster-api-controller:v1.10.6 gives cluster-api/cluster-api-controller:v1.10.6
+func StripRegistry(image string) string {
+	first, rest, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return rest
+	}
+	return image
+}
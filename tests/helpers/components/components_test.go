@@ -0,0 +1,153 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package components_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/components"
+)
+
+// componentsYAML is a provider component manifest, with a document without name
+const componentsYAML = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: capa-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: capa-controller-manager
+  namespace: capa-system
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: registry.rancher.com/rancher/busybox:1.36
+      containers:
+      - name: manager
+        image: ${REGISTRY:=registry.rancher.com}/rancher/cluster-api-aws-controller:v2.11.0
+      - name: sidecar
+        image: docker.io/rancher/kube-rbac-proxy:v0.19.1
+---
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: capa-system
+`
+
+// tarball returns a gzipped tarball of the files, as oras pushes a directory
+func tarball(files map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	Expect(tw.WriteHeader(&tar.Header{Name: "infrastructure-aws/", Typeflag: tar.TypeDir, Mode: 0o755})).To(Succeed())
+	for name, content := range files {
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))})).To(Succeed())
+		_, err := tw.Write([]byte(content))
+		Expect(err).To(Not(HaveOccurred()))
+	}
+	Expect(tw.Close()).To(Succeed())
+	Expect(gw.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("Components", func() {
+	It("parses the objects of a manifest and the images they reference", func() {
+		objects, err := components.Parse(components.File{Name: "infrastructure-components.yaml", Data: []byte(componentsYAML)})
+
+		Expect(err).To(MatchError(ContainSubstring("infrastructure-components.yaml: document 3 is not a valid Kubernetes object")))
+		Expect(objects).To(HaveLen(2))
+		Expect(objects[0]).To(Equal(components.Object{File: "infrastructure-components.yaml", APIVersion: "v1", Kind: "Namespace", Name: "capa-system"}))
+		Expect(objects[1].String()).To(Equal("Deployment capa-system/capa-controller-manager (infrastructure-components.yaml)"))
+		// Every image field is found, containers before initContainers as the keys are sorted
+		Expect(objects[1].Images).To(Equal([]string{
+			"${REGISTRY:=registry.rancher.com}/rancher/cluster-api-aws-controller:v2.11.0",
+			"docker.io/rancher/kube-rbac-proxy:v0.19.1",
+			"registry.rancher.com/rancher/busybox:1.36",
+		}))
+	})
+
+	It("fails on a file that is not YAML", func() {
+		_, err := components.Parse(components.File{Name: "broken.yaml", Data: []byte("kind: [")})
+		Expect(err).To(MatchError(ContainSubstring("broken.yaml: document 0")))
+	})
+
+	DescribeTable("strips the registry of an image",
+		func(image, expected string) {
+			Expect(components.StripRegistry(image)).To(Equal(expected))
+		},
+		Entry("with a registry", "registry.k8s.io/cluster-api/cluster-api-controller:v1.10.6", "cluster-api/cluster-api-controller:v1.10.6"),
+		Entry("with a registry port", "localhost:5000/rancher/turtles:v0.26.0", "rancher/turtles:v0.26.0"),
+		Entry("with localhost", "localhost/rancher/turtles:v0.26.0", "rancher/turtles:v0.26.0"),
+		Entry("without registry", "rancher/turtles:v0.26.0", "rancher/turtles:v0.26.0"),
+		Entry("without repository", "busybox:1.36", "busybox:1.36"),
+	)
+
+	DescribeTable("tells the manifest files",
+		func(file string, expected bool) {
+			Expect(components.IsManifest(components.File{Name: file})).To(Equal(expected))
+		},
+		Entry("components", "infrastructure-components.yaml", true),
+		Entry("in a directory", "infrastructure-aws/v2.11.0/cluster-template.yml", true),
+		Entry("metadata", "infrastructure-aws/v2.11.0/metadata.yaml", false),
+		Entry("not YAML", "README.md", false),
+	)
+
+	It("pulls the files of an artifact, extracting the tarballs", func() {
+		server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(server.Close)
+
+		files := map[string]string{
+			"infrastructure-aws/v2.11.0/infrastructure-components.yaml": componentsYAML,
+			"infrastructure-aws/v2.11.0/metadata.yaml":                  "apiVersion: clusterctl.cluster.x-k8s.io/v1alpha3\n",
+		}
+		dir := static.NewLayer(tarball(files), types.OCILayer)
+		file := static.NewLayer([]byte("# CAPA\n"), "text/markdown")
+		image, err := mutate.Append(empty.Image,
+			mutate.Addendum{Layer: dir},
+			mutate.Addendum{Layer: file, Annotations: map[string]string{"org.opencontainers.image.title": "README.md"}},
+		)
+		Expect(err).To(Not(HaveOccurred()))
+		ref, err := name.ParseReference(strings.TrimPrefix(server.URL, "http://")+"/rancher/cluster-api-aws-controller-components:v2.11.0", name.Insecure)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(remote.Write(ref, image)).To(Succeed())
+
+		pulled, err := components.PullReference(ref)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(pulled).To(Equal([]components.File{
+			{Name: "README.md", Data: []byte("# CAPA\n")},
+			{Name: "infrastructure-aws/v2.11.0/infrastructure-components.yaml", Data: []byte(componentsYAML)},
+			{Name: "infrastructure-aws/v2.11.0/metadata.yaml", Data: []byte(files["infrastructure-aws/v2.11.0/metadata.yaml"])},
+		}))
+	})
+})
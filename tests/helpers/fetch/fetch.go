@@ -0,0 +1,296 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fetch downloads the source documents read by the tests (build.yaml, clusterctl configs,
+// image lists, ...): it checks status codes, retries on rate limits and server errors, caches
+// documents on disk by ETag and records where every document came from.
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultGitHubHosts are the hosts GITHUB_TOKEN is sent to
+var DefaultGitHubHosts = []string{"github.com", "api.github.com", "raw.githubusercontent.com"}
+
+// StatusError is returned for a non-200 answer
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Body       string // beginning of the body, e.g. a rate limit message
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: HTTP %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// IsNotFound tells if the document does not exist, e.g. a wrong release tag
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// Record is the provenance of a document read
+type Record struct {
+	URL       string    `json:"url"`
+	Status    int       `json:"status"` // last status received, 304 when served from the cache
+	SHA256    string    `json:"sha256"`
+	Size      int       `json:"size"`
+	Cached    bool      `json:"cached"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// cacheEntry is the metadata of a cached document, stored next to its body
+type cacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// Fetcher downloads documents, create it with New
+type Fetcher struct {
+	client      *http.Client
+	cacheDir    string
+	token       string
+	tokenHosts  map[string]bool
+	retries     int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	mu          sync.Mutex
+	provenances []Record
+}
+
+// Option configures a Fetcher
+type Option func(*Fetcher)
+
+// WithHTTPClient sets the HTTP client
+func WithHTTPClient(client *http.Client) Option {
+	return func(f *Fetcher) { f.client = client }
+}
+
+// WithCacheDir keeps the documents and their ETag in dir, no cache when empty
+func WithCacheDir(dir string) Option {
+	return func(f *Fetcher) { f.cacheDir = dir }
+}
+
+// WithGitHubToken sends token to the GitHub hosts, or to hosts when set
+func WithGitHubToken(token string, hosts ...string) Option {
+	return func(f *Fetcher) {
+		f.token = token
+		if len(hosts) == 0 {
+			hosts = DefaultGitHubHosts
+		}
+		f.tokenHosts = map[string]bool{}
+		for _, h := range hosts {
+			f.tokenHosts[h] = true
+		}
+	}
+}
+
+// WithRetries sets the number of retries on 429, 5xx and network errors, and the first backoff, doubled on each retry
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(f *Fetcher) {
+		f.retries = retries
+		f.backoff = backoff
+	}
+}
+
+// New creates a fetcher, by default retrying 4 times from 2s
+func New(opts ...Option) *Fetcher {
+	f := &Fetcher{
+		client:     &http.Client{Timeout: 60 * time.Second},
+		retries:    4,
+		backoff:    2 * time.Second,
+		maxBackoff: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Get downloads a document, or returns its cached copy when the server answers it did not change
+func (f *Fetcher) Get(rawURL string) ([]byte, error) {
+	entry, cached := f.readCache(rawURL)
+
+	var lastErr error
+	backoff := f.backoff
+	for attempt := 0; attempt <= f.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff = min(backoff*2, f.maxBackoff)
+		}
+
+		body, wait, err := f.get(rawURL, entry, cached)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if wait < 0 {
+			// Not worth retrying, e.g. 404
+			break
+		}
+		if wait > 0 {
+			backoff = min(wait, f.maxBackoff)
+		}
+	}
+	return nil, lastErr
+}
+
+/**
+ * Send one request
+ * @param rawURL URL of the document
+ * @param entry Cache metadata of the document
+ * @param cached Cached body of the document, nil if not cached
+ * @returns The body, the time to wait before retrying (0 for the default backoff, -1 not to retry) and the error
+ */
+func (f *Fetcher) get(rawURL string, entry cacheEntry, cached []byte) ([]byte, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, -1, err
+	}
+	if f.token != "" {
+		if u, err := url.Parse(rawURL); err == nil && f.tokenHosts[u.Hostname()] {
+			req.Header.Set("Authorization", "Bearer "+f.token)
+		}
+	}
+	if cached != nil {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		f.record(rawURL, resp.StatusCode, cached, true)
+		return cached, 0, nil
+	case resp.StatusCode == http.StatusOK:
+		f.writeCache(rawURL, resp.Header, body)
+		f.record(rawURL, resp.StatusCode, body, false)
+		return body, 0, nil
+	}
+
+	statusErr := &StatusError{URL: rawURL, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body[:min(len(body), 200)]))}
+	// GitHub also answers 403 when the rate limit is exceeded
+	rateLimited := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0")
+	if !rateLimited && resp.StatusCode < 500 {
+		return nil, -1, statusErr
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return nil, time.Duration(seconds) * time.Second, statusErr
+	}
+	return nil, 0, statusErr
+}
+
+// cachePath returns the path of the cached body of a document, its metadata has a .json suffix
+func (f *Fetcher) cachePath(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(f.cacheDir, hex.EncodeToString(sum[:]))
+}
+
+func (f *Fetcher) readCache(rawURL string) (cacheEntry, []byte) {
+	if f.cacheDir == "" {
+		return cacheEntry{}, nil
+	}
+	path := f.cachePath(rawURL)
+	data, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return cacheEntry{}, nil
+	}
+	var entry cacheEntry
+	if json.Unmarshal(data, &entry) != nil || entry.URL != rawURL {
+		return cacheEntry{}, nil
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return cacheEntry{}, nil
+	}
+	return entry, body
+}
+
+// writeCache stores a document served with an ETag or Last-Modified, errors are ignored as the cache is an optimization
+func (f *Fetcher) writeCache(rawURL string, header http.Header, body []byte) {
+	entry := cacheEntry{URL: rawURL, ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}
+	if f.cacheDir == "" || (entry.ETag == "" && entry.LastModified == "") {
+		return
+	}
+	if err := os.MkdirAll(f.cacheDir, 0o755); err != nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	path := f.cachePath(rawURL)
+	if os.WriteFile(path, body, 0o644) == nil {
+		_ = os.WriteFile(path+".json", data, 0o644)
+	}
+}
+
+func (f *Fetcher) record(rawURL string, status int, body []byte, cached bool) {
+	sum := sha256.Sum256(body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.provenances = append(f.provenances, Record{
+		URL:       rawURL,
+		Status:    status,
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      len(body),
+		Cached:    cached,
+		FetchedAt: time.Now().UTC(),
+	})
+}
+
+// Provenance returns the records of the documents read, in order
+func (f *Fetcher) Provenance() []Record {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Record(nil), f.provenances...)
+}
+
+// WriteProvenance writes the records of the documents read as JSON
+func (f *Fetcher) WriteProvenance(path string) error {
+	data, err := json.MarshalIndent(f.Provenance(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fetch_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/fetch"
+)
+
+var _ = Describe("Fetcher", func() {
+	var (
+		server   *httptest.Server
+		handler  http.HandlerFunc
+		requests atomic.Int32
+	)
+
+	BeforeEach(func() {
+		requests.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			handler(w, r)
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	It("returns the body of a 200 answer and records its provenance", func() {
+		handler = func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("turtlesVersion: 108.0.0+up0.26.0\n"))
+		}
+		f := fetch.New()
+
+		body, err := f.Get(server.URL + "/build.yaml")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(body)).To(Equal("turtlesVersion: 108.0.0+up0.26.0\n"))
+
+		sum := sha256.Sum256(body)
+		Expect(f.Provenance()).To(ConsistOf(And(
+			HaveField("URL", server.URL+"/build.yaml"),
+			HaveField("Status", http.StatusOK),
+			HaveField("SHA256", hex.EncodeToString(sum[:])),
+			HaveField("Cached", false),
+		)))
+	})
+
+	It("fails without retrying on a 404", func() {
+		handler = func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "404: Not Found", http.StatusNotFound)
+		}
+		f := fetch.New(fetch.WithRetries(3, time.Millisecond))
+
+		_, err := f.Get(server.URL + "/refs/tags/v0.0.0-typo/build.yaml")
+		Expect(err).To(HaveOccurred())
+		Expect(fetch.IsNotFound(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("404: Not Found"))
+		Expect(requests.Load()).To(BeEquivalentTo(1))
+		Expect(f.Provenance()).To(BeEmpty())
+	})
+
+	It("retries on server errors and rate limits", func() {
+		handler = func(w http.ResponseWriter, _ *http.Request) {
+			switch requests.Load() {
+			case 1:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case 2:
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+			case 3:
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.WriteHeader(http.StatusForbidden)
+			default:
+				_, _ = w.Write([]byte("ok"))
+			}
+		}
+		f := fetch.New(fetch.WithRetries(3, time.Millisecond))
+
+		body, err := f.Get(server.URL)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(body)).To(Equal("ok"))
+		Expect(requests.Load()).To(BeEquivalentTo(4))
+	})
+
+	It("gives up after the last retry", func() {
+		handler = func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		f := fetch.New(fetch.WithRetries(2, time.Millisecond))
+
+		_, err := f.Get(server.URL)
+		var statusErr *fetch.StatusError
+		Expect(err).To(BeAssignableToTypeOf(statusErr))
+		Expect(requests.Load()).To(BeEquivalentTo(3))
+	})
+
+	It("serves unchanged documents from the ETag cache", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte("cached content"))
+		}
+		cacheDir := GinkgoT().TempDir()
+
+		first := fetch.New(fetch.WithCacheDir(cacheDir))
+		body, err := first.Get(server.URL + "/config.yaml")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(body)).To(Equal("cached content"))
+
+		second := fetch.New(fetch.WithCacheDir(cacheDir))
+		body, err = second.Get(server.URL + "/config.yaml")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(string(body)).To(Equal("cached content"))
+		Expect(second.Provenance()).To(ConsistOf(And(
+			HaveField("Status", http.StatusNotModified),
+			HaveField("Cached", true),
+		)))
+	})
+
+	It("sends the GitHub token to GitHub hosts only", func() {
+		var authorization string
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+		}
+		u, err := url.Parse(server.URL)
+		Expect(err).To(Not(HaveOccurred()))
+
+		_, err = fetch.New(fetch.WithGitHubToken("secret", u.Hostname())).Get(server.URL)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(authorization).To(Equal("Bearer secret"))
+
+		_, err = fetch.New(fetch.WithGitHubToken("secret")).Get(server.URL)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(authorization).To(BeEmpty())
+	})
+
+	It("writes the provenance as JSON", func() {
+		handler = func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("rancher/turtles:v0.26.0\n"))
+		}
+		f := fetch.New()
+		_, err := f.Get(server.URL + "/rancher-images.txt")
+		Expect(err).To(Not(HaveOccurred()))
+
+		path := filepath.Join(GinkgoT().TempDir(), "provenance.json")
+		Expect(f.WriteProvenance(path)).To(Succeed())
+		data, err := os.ReadFile(path)
+		Expect(err).To(Not(HaveOccurred()))
+
+		var records []fetch.Record
+		Expect(json.Unmarshal(data, &records)).To(Succeed())
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].URL).To(Equal(server.URL + "/rancher-images.txt"))
+	})
+})
@@ -0,0 +1,171 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AirgapRegistryContainer is the container started for a local airgap registry
+	AirgapRegistryContainer = "turtles-airgap-registry"
+	// AirgapEgressChain is the iptables chain rejecting outbound traffic
+	AirgapEgressChain = "TURTLES-AIRGAP"
+	// airgapOutputChain accepts the host traffic of the users exempted from the egress block
+	airgapOutputChain = AirgapEgressChain + "-OUTPUT"
+)
+
+// RunSudo runs a command as root
+func RunSudo(args ...string) error {
+	out, err := exec.Command("sudo", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sudo %s: %w: %s", strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+// RegistryReachable tells if a registry answers the OCI distribution API over plain HTTP
+func RegistryReachable(registry string) bool {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + registry + "/v2/")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+/**
+ * Start a registry container for the airgap registry, unless a registry already answers
+ * @param registry Registry host, e.g. localhost:5000
+ * @param dataDir Directory keeping the registry content across restarts
+ * @returns true if the registry was already running
+ */
+func EnsureRegistry(registry, dataDir string) (bool, error) {
+	if RegistryReachable(registry) {
+		return true, nil
+	}
+
+	host, port, found := strings.Cut(registry, ":")
+	if !found || (host != "localhost" && host != "127.0.0.1") {
+		return false, fmt.Errorf("registry %s is not reachable and is not local, it must be started beforehand", registry)
+	}
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return false, err
+	}
+
+	out, err := exec.Command("docker", "run", "--detach", "--restart=always", "--name", AirgapRegistryContainer,
+		"--publish", port+":5000", "--volume", dataDir+":/var/lib/registry", "registry:2").CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("starting registry container: %w: %s", err, out)
+	}
+
+	err = Retry(time.Minute, 2*time.Second, func() error {
+		if !RegistryReachable(registry) {
+			return fmt.Errorf("registry %s did not start", registry)
+		}
+		return nil
+	})
+	return false, err
+}
+
+// RemoveRegistry removes the registry container started by EnsureRegistry, nothing is done if it does not exist
+func RemoveRegistry() error {
+	if exec.Command("docker", "container", "inspect", AirgapRegistryContainer).Run() != nil {
+		return nil
+	}
+	if out, err := exec.Command("docker", "rm", "--force", AirgapRegistryContainer).CombinedOutput(); err != nil {
+		return fmt.Errorf("removing registry container: %w: %s", err, out)
+	}
+	return nil
+}
+
+// egressCommands are the iptables commands of each address family with the private ranges left reachable
+var egressCommands = []struct {
+	command string
+	cidrs   []string
+}{
+	{"iptables", []string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16"}},
+	{"ip6tables", []string{"::1/128", "fc00::/7", "fe80::/10"}},
+}
+
+// BlockEgress rejects the IPv4 and IPv6 traffic leaving the host and its pods, except to local and private
+// addresses and the host traffic of exemptUIDs, e.g. the user running a proxy
+func BlockEgress(exemptUIDs ...int) error {
+	// Every process run through sudo would escape the block
+	if slices.Contains(exemptUIDs, 0) {
+		return errors.New("root cannot be exempted from the egress block, run the proxy as another user")
+	}
+	for _, family := range egressCommands {
+		for _, rule := range egressRules(family.cidrs, exemptUIDs) {
+			if err := RunSudo(append([]string{family.command}, rule...)...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// egressRules returns the rules of BlockEgress for one address family
+func egressRules(cidrs []string, exemptUIDs []int) [][]string {
+	rules := [][]string{
+		{"-N", AirgapEgressChain},
+		{"-A", AirgapEgressChain, "-m", "addrtype", "--dst-type", "LOCAL", "-j", "RETURN"},
+	}
+	for _, cidr := range cidrs {
+		rules = append(rules, []string{"-A", AirgapEgressChain, "-d", cidr, "-j", "RETURN"})
+	}
+	rules = append(rules, []string{"-A", AirgapEgressChain, "-j", "REJECT"})
+
+	// The owner match is only valid in OUTPUT, so exempted users are accepted in a chain of their own
+	output := AirgapEgressChain
+	if len(exemptUIDs) > 0 {
+		output = airgapOutputChain
+		rules = append(rules, []string{"-N", output})
+		for _, uid := range exemptUIDs {
+			rules = append(rules, []string{"-A", output, "-m", "owner", "--uid-owner", strconv.Itoa(uid), "-j", "ACCEPT"})
+		}
+		rules = append(rules, []string{"-A", output, "-j", AirgapEgressChain})
+	}
+	return append(rules,
+		[]string{"-I", "OUTPUT", "-j", output},
+		[]string{"-I", "FORWARD", "-j", AirgapEgressChain},
+	)
+}
+
+// UnblockEgress removes the rules added by BlockEgress, errors are ignored as rules may be missing
+func UnblockEgress() {
+	for _, family := range egressCommands {
+		for _, args := range [][]string{
+			{"-D", "OUTPUT", "-j", AirgapEgressChain},
+			{"-D", "OUTPUT", "-j", airgapOutputChain},
+			{"-D", "FORWARD", "-j", AirgapEgressChain},
+			{"-F", airgapOutputChain},
+			{"-X", airgapOutputChain},
+			{"-F", AirgapEgressChain},
+			{"-X", AirgapEgressChain},
+		} {
+			_ = exec.Command("sudo", append([]string{family.command}, args...)...).Run()
+		}
+	}
+}
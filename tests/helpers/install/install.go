@@ -0,0 +1,166 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package install installs, upgrades and removes K3s, cert-manager and Rancher Manager on the
+// host. It is shared by the Ginkgo specs and the turtles-e2e command, so functions return errors
+// and let the caller decide how to report them.
+package install
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+)
+
+// CAPIProvidersResource is the resource of the Turtles CAPIProviders
+const CAPIProvidersResource = "capiproviders.turtles-capi.cattle.io"
+
+// Deployment is a deployment waited for during an install
+type Deployment struct {
+	Namespace string
+	Name      string
+}
+
+var (
+	// K3sDeployments are the K3s deployments the next steps depend on
+	K3sDeployments = []Deployment{
+		{"kube-system", "local-path-provisioner"},
+		{"kube-system", "coredns"},
+		{"kube-system", "traefik"},
+	}
+
+	// TurtlesDeployments are the Turtles and core CAPI controllers deployed by Rancher >= 2.13
+	TurtlesDeployments = []Deployment{
+		{"cattle-turtles-system", "rancher-turtles-controller-manager"},
+		{"cattle-capi-system", "capi-controller-manager"},
+	}
+)
+
+/**
+ * Retry a function until it succeeds or the timeout expires
+ * @param timeout Timeout, scaled like the Ginkgo specs ones
+ * @param interval Time between two attempts
+ * @param f Function to retry
+ * @returns The last error, nil on success
+ */
+func Retry(timeout, interval time.Duration, f func() error) error {
+	deadline := time.Now().Add(tools.SetTimeout(timeout))
+	for {
+		err := f()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// RunHelmWithRetry runs helm until it succeeds, for up to 2 minutes, and returns the output of all attempts
+func RunHelmWithRetry(args ...string) (string, error) {
+	var output strings.Builder
+	err := Retry(2*time.Minute, 20*time.Second, func() error {
+		out, err := kubectl.RunHelmBinaryWithOutput(args...)
+		output.WriteString(out)
+		return err
+	})
+	return output.String(), err
+}
+
+/**
+ * Wait for a resource to be created, then for one of its conditions
+ * @param ns Namespace of the resource
+ * @param resource Resource, e.g. deployment/coredns
+ * @param condition Condition to wait for, e.g. Available
+ * @returns The kubectl output
+ */
+func WaitForCondition(ns, resource, condition string) (string, error) {
+	status, err := kubectl.Run("wait", "--namespace", ns, "--for=create", resource, "--timeout=300s")
+	if err != nil {
+		return status, fmt.Errorf("kubectl wait --for=create %s failed: %w: %s", resource, err, status)
+	}
+
+	out, err := kubectl.Run("wait", "--namespace", ns, "--for=condition="+condition, resource, "--timeout=300s")
+	status += out
+	if err != nil {
+		return status, fmt.Errorf("kubectl wait --for=condition=%s %s failed: %w: %s", condition, resource, err, out)
+	}
+	return status, nil
+}
+
+// WaitForDeployments waits for the deployments to be Available
+func WaitForDeployments(deployments []Deployment) error {
+	for _, d := range deployments {
+		if _, err := WaitForCondition(d.Namespace, "deployments/"+d.Name, "Available"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * Split RANCHER_VERSION into its parts
+ * @param s Rancher channel and version, e.g. prime/2.14.1, latest/devel/2.14 or head/2.14
+ * @returns Channel, version and head version, e.g. devel for latest/devel/2.14
+ */
+func ParseRancherVersion(s string) (channel, version, headVersion string) {
+	parts := strings.Split(s, "/")
+	channel = parts[0]
+	if len(parts) > 1 {
+		version = parts[1]
+	}
+	if len(parts) > 2 {
+		headVersion = parts[2]
+	}
+	return channel, version, headVersion
+}
+
+/**
+ * Check if a Rancher version satisfies a semver constraint
+ * The version is the last part of RANCHER_VERSION, pre-releases are compared as their release
+ * @param rancherVersion Rancher channel and version, e.g. head/2.13, alpha/2.13.1-rc1 or latest/devel/2.12
+ * @param constraint Semver constraint, e.g. >=2.13
+ * @returns true if the version satisfies the constraint
+ */
+func RancherVersionMatches(rancherVersion, constraint string) (bool, error) {
+	// It is always the last member of RANCHER_VERSION
+	parts := strings.Split(rancherVersion, "/")
+	versionStr := strings.TrimSpace(parts[len(parts)-1])
+	if !regexp.MustCompile(`^\d+\.\d+`).MatchString(versionStr) {
+		return false, fmt.Errorf("last part of RANCHER_VERSION %q does not contain a valid version (expected at least MAJOR.MINOR)", rancherVersion)
+	}
+
+	// Strip pre-release suffix "2.13.0-alpha8" or "2.13.0-rc1" -> "2.13.0"
+	if idx := strings.IndexAny(versionStr, "-"); idx != -1 {
+		versionStr = versionStr[:idx]
+	}
+
+	// Coerce "2.13" -> "2.13.0"
+	if strings.Count(versionStr, ".") == 1 {
+		versionStr += ".0"
+	}
+
+	v, err := semver.NewVersion(versionStr)
+	if err != nil {
+		return false, err
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+	return c.Check(v), nil
+}
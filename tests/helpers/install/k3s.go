@@ -0,0 +1,107 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/tools"
+)
+
+const (
+	K3sInstallerFile    = "k3s-install.sh"
+	K3sInstallerVersion = "v1.36.2+k3s1"
+	K3sInstallerURL     = "https://raw.githubusercontent.com/k3s-io/k3s/" + K3sInstallerVersion + "/install.sh"
+	K3sInstallerSHA256  = "46177d4c99440b4c0311b67233823a8e8a2fc09693f6c89af1a7161e152fbfad"
+
+	// K3sKubeconfig is the kubeconfig written by K3s
+	K3sKubeconfig = "/etc/rancher/k3s/k3s.yaml"
+)
+
+// SHA256File returns the hex encoded sha256 of a file
+func SHA256File(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DownloadK3sInstaller downloads the pinned K3s installer to path and verifies its checksum
+func DownloadK3sInstaller(path string) error {
+	err := Retry(2*time.Minute, 10*time.Second, func() error {
+		return tools.GetFileFromURL(K3sInstallerURL, path, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Verify installer integrity before execution
+	scriptSHA, err := SHA256File(path)
+	if err != nil {
+		return err
+	}
+	if scriptSHA != K3sInstallerSHA256 {
+		return fmt.Errorf("k3s installer %s checksum mismatch: expected=%s actual=%s", K3sInstallerVersion, K3sInstallerSHA256, scriptSHA)
+	}
+	return nil
+}
+
+/**
+ * Execute the K3s installer
+ * @param path Path of the installer
+ * @param env Extra installer variables, e.g. INSTALL_K3S_SKIP_DOWNLOAD=true
+ * @returns The installer output
+ */
+func RunK3sInstaller(path string, env ...string) ([]byte, error) {
+	installCmd := exec.Command("sh", path)
+	installCmd.Env = append(os.Environ(), "INSTALL_K3S_EXEC=--disable metrics-server --write-kubeconfig-mode 0644", "INSTALL_K3S_SKIP_SELINUX_RPM=true")
+	installCmd.Env = append(installCmd.Env, env...)
+	return installCmd.CombinedOutput()
+}
+
+// StartK3s starts the K3s service and points KUBECONFIG to its kubeconfig
+func StartK3s() error {
+	if out, err := exec.Command("sudo", "systemctl", "start", "k3s").CombinedOutput(); err != nil {
+		return fmt.Errorf("starting k3s: %w: %s", err, out)
+	}
+	return os.Setenv("KUBECONFIG", K3sKubeconfig)
+}
+
+// UninstallK3s stops K3s and removes it with the scripts left by the installer, nothing is done if K3s is not installed
+func UninstallK3s() error {
+	for _, script := range []string{"/usr/local/bin/k3s-killall.sh", "/usr/local/bin/k3s-uninstall.sh"} {
+		if _, err := os.Stat(script); err != nil {
+			continue
+		}
+		if out, err := exec.Command("sudo", script).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %w: %s", script, err, out)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+)
+
+// logCommands are the kubectl commands whose output is saved by CollectLogs, by file name
+var logCommands = map[string][]string{
+	"pods.txt":            {"get", "pods", "--all-namespaces", "-o", "wide"},
+	"events.txt":          {"get", "events", "--all-namespaces", "--sort-by=.lastTimestamp"},
+	"capiproviders.yaml":  {"get", CAPIProvidersResource, "--all-namespaces", "-o", "yaml"},
+	"clusters.yaml":       {"get", "clusters.cluster.x-k8s.io", "--all-namespaces", "-o", "yaml"},
+	"rancher-config.yaml": {"get", "configmap", "rancher-config", "-n", "cattle-system", "-o", "yaml"},
+}
+
+/**
+ * Collect the state and logs of Rancher, Turtles and CAPI
+ * Commands failing, e.g. on a missing CRD, are reported but do not stop the collection.
+ * @param dir Directory where to write the logs
+ * @param script Log collector script run in dir, e.g. RANCHER_LOG_COLLECTOR, skipped when empty
+ * @returns The errors of the commands that failed
+ */
+func CollectLogs(dir, script string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	var errs []error
+	save := func(file, out string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+		}
+		if writeErr := os.WriteFile(filepath.Join(dir, file), []byte(out), 0o644); writeErr != nil {
+			errs = append(errs, writeErr)
+		}
+	}
+
+	for file, args := range logCommands {
+		out, err := kubectl.Run(args...)
+		save(file, out, err)
+	}
+	out, err := kubectl.RunHelmBinaryWithOutput("list", "--all-namespaces", "--all")
+	save("helm-releases.txt", out, err)
+	for _, d := range append(TurtlesDeployments, Deployment{"cattle-system", "rancher"}) {
+		out, err := kubectl.Run("logs", "--namespace", d.Namespace, "deployments/"+d.Name, "--all-containers", "--timestamps")
+		save(d.Name+".log", out, err)
+	}
+
+	if script != "" {
+		script, err := filepath.Abs(script)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		cmd := exec.Command(script)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w: %s", script, err, out))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,247 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/precheck"
+)
+
+const (
+	// PreflightArtifact is the artifact of the host checks in the precheck table
+	PreflightArtifact = "host"
+
+	// Minimal inotify limits, kind and the CAPD clusters run out of them with the distribution defaults
+	MinInotifyInstances = 512
+	MinInotifyWatches   = 524288
+
+	// KindNetwork is the docker network CAPD attaches its clusters to
+	KindNetwork = "kind"
+)
+
+// K3sPorts are the ports K3s and its ingress controller listen on
+var K3sPorts = []int{80, 443, 6443}
+
+// Preflight is what the host must provide for an install mode
+type Preflight struct {
+	Ports       []int    // ports the install listens on, they must be free
+	Commands    []string // commands that must be in PATH
+	Docker      bool     // docker daemon reachable, e.g. for the airgap registry
+	KindNetwork bool     // bridge network the CAPD clusters are attached to
+	MinDiskGiB  uint64   // free space where K3s and docker store their data, /var/lib
+}
+
+// PreflightMode is the install mode the host is checked for
+type PreflightMode struct {
+	DevTurtlesChart bool   // the git server of the dev system charts already listens, on SystemChartsGitPort or ChartServerPort
+	ChartServerPort string // port the chart server of the suite already listens on, if any
+	CAPD            bool   // CAPD clusters are created, in docker
+	Airgap          bool   // artifacts and images are mirrored to a local registry
+	ProxyPort       int    // port of the forward proxy of the proxy install, 0 without
+}
+
+// NewPreflight returns what the host must provide for an install mode
+func NewPreflight(mode PreflightMode) (Preflight, error) {
+	p := Preflight{Commands: []string{"helm"}, MinDiskGiB: 20}
+	// A resumed install finds its own K3s listening
+	if !K3sRunning() {
+		p.Ports = append(p.Ports, K3sPorts...)
+	}
+	// The git server is started before the install, the chart server serves the system charts on its own port
+	if !mode.DevTurtlesChart && mode.ChartServerPort == "" {
+		gitPort, err := strconv.Atoi(SystemChartsGitPort)
+		if err != nil {
+			return p, err
+		}
+		p.Ports = append(p.Ports, gitPort)
+	}
+	// The chart server serves the charts to Cypress on 8080, unless it already listens there
+	if mode.ChartServerPort != "8080" {
+		p.Ports = append(p.Ports, 8080)
+	}
+	if mode.CAPD {
+		p.Docker = true
+		p.KindNetwork = true
+	}
+	if mode.Airgap {
+		p.Commands = append(p.Commands, "docker", "iptables", "sudo")
+		p.Docker = true
+		// Artifacts and images are stored twice, as files and in the registry
+		p.MinDiskGiB = 40
+	}
+	if mode.ProxyPort != 0 {
+		p.Commands = append(p.Commands, "curl", "iptables", "sudo")
+		p.Ports = append(p.Ports, mode.ProxyPort)
+	}
+	return p, nil
+}
+
+// Checks returns the checks of the host, to run with precheck.RunChecks
+func (p Preflight) Checks() []precheck.Check {
+	checks := []precheck.Check{
+		{Artifact: PreflightArtifact, Name: "inotify limits", Run: checkInotify},
+		{Artifact: PreflightArtifact, Name: "br_netfilter loaded", Run: checkBrNetfilter},
+	}
+	if p.MinDiskGiB > 0 {
+		checks = append(checks, precheck.Check{Artifact: PreflightArtifact, Name: "free disk in /var/lib", Run: func() error {
+			return checkDisk("/var/lib", p.MinDiskGiB)
+		}})
+	}
+	if len(p.Ports) > 0 {
+		checks = append(checks, precheck.Check{Artifact: PreflightArtifact, Name: "free ports", Run: func() error {
+			return checkPorts(p.Ports)
+		}})
+	}
+	for _, command := range p.Commands {
+		checks = append(checks, precheck.Check{Artifact: PreflightArtifact, Name: "command " + command, Run: func() error {
+			_, err := exec.LookPath(command)
+			return err
+		}})
+	}
+	if p.Docker || p.KindNetwork {
+		checks = append(checks, precheck.Check{Artifact: PreflightArtifact, Name: "docker daemon", Run: checkDocker})
+	}
+	if p.KindNetwork {
+		checks = append(checks, precheck.Check{Artifact: PreflightArtifact, Name: "docker network " + KindNetwork, Run: checkKindNetwork})
+	}
+	return checks
+}
+
+// readSysctl reads an integer kernel setting, e.g. /proc/sys/fs/inotify/max_user_watches
+func readSysctl(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func checkInotify() error {
+	var errs []error
+	for _, limit := range []struct {
+		name string
+		min  int
+	}{
+		{"fs.inotify.max_user_instances", MinInotifyInstances},
+		{"fs.inotify.max_user_watches", MinInotifyWatches},
+	} {
+		value, err := readSysctl("/proc/sys/" + strings.ReplaceAll(limit.name, ".", "/"))
+		if err != nil {
+			errs = append(errs, err)
+		} else if value < limit.min {
+			errs = append(errs, fmt.Errorf("%s is %d, raise it with sudo sysctl -w %s=%d", limit.name, value, limit.name, limit.min))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkBrNetfilter() error {
+	// Only present when the module is loaded, or built in
+	if _, err := os.Stat("/proc/sys/net/bridge/bridge-nf-call-iptables"); err != nil {
+		return errors.New("br_netfilter is not loaded, load it with sudo modprobe br_netfilter")
+	}
+	return nil
+}
+
+func checkDisk(path string, minGiB uint64) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fmt.Errorf("statfs %s: %w", path, err)
+	}
+	free := uint64(st.Bavail) * uint64(st.Bsize) >> 30
+	if free < minGiB {
+		return fmt.Errorf("%d GiB free in %s, %d GiB needed", free, path, minGiB)
+	}
+	return nil
+}
+
+/**
+ * Check no socket listens on the ports, as listed by the kernel
+ * Binding the ports instead would need root for 80 and 443.
+ * @param ports Ports to check
+ * @returns One error per port in use
+ */
+func checkPorts(ports []int) error {
+	listening := map[int]bool{}
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(table)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // no IPv6
+		}
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			// sl local_address rem_address st ..., e.g. 0: 00000000:1F90 00000000:0000 0A
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 || fields[3] != "0A" { // TCP_LISTEN
+				continue
+			}
+			_, hexPort, _ := strings.Cut(fields[1], ":")
+			if port, err := strconv.ParseInt(hexPort, 16, 32); err == nil {
+				listening[int(port)] = true
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+
+	var errs []error
+	for _, port := range ports {
+		if listening[port] {
+			errs = append(errs, fmt.Errorf("port %d is in use, see sudo ss -ltnp 'sport = :%d'", port, port))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// commandError returns the error of a command with its output, if any
+func commandError(msg string, err error, out []byte) error {
+	if detail := strings.TrimSpace(string(out)); detail != "" {
+		return fmt.Errorf("%s: %w: %s", msg, err, detail)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+func checkDocker() error {
+	if out, err := exec.Command("docker", "info", "--format", "{{.ServerVersion}}").CombinedOutput(); err != nil {
+		return commandError("docker daemon not reachable", err, out)
+	}
+	return nil
+}
+
+func checkKindNetwork() error {
+	out, err := exec.Command("docker", "network", "inspect", KindNetwork, "--format", "{{.Driver}}").CombinedOutput()
+	if err != nil {
+		return commandError(fmt.Sprintf("docker network %s not found, create it with docker network create %s", KindNetwork, KindNetwork), err, out)
+	}
+	if driver := strings.TrimSpace(string(out)); driver != "bridge" {
+		return fmt.Errorf("docker network %s uses the %s driver, not bridge", KindNetwork, driver)
+	}
+	return nil
+}
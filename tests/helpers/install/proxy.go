@@ -0,0 +1,160 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+)
+
+// DefaultNoProxy are the destinations never reached through the proxy, same as the Rancher chart default
+var DefaultNoProxy = []string{"127.0.0.0/8", "10.0.0.0/8", "cattle-system.svc", "172.16.0.0/12", "192.168.0.0/16", ".svc", ".cluster.local", "localhost"}
+
+// proxyEnvNames are the variables set by ProxyConfig
+var proxyEnvNames = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+// ProxyConfig is the HTTP(S) proxy K3s, Rancher and the controllers go through
+type ProxyConfig struct {
+	URL     string
+	NoProxy []string
+}
+
+// NewProxyConfig creates a proxy configuration, noProxy is added to DefaultNoProxy
+func NewProxyConfig(url string, noProxy ...string) ProxyConfig {
+	return ProxyConfig{URL: url, NoProxy: append(slices.Clone(DefaultNoProxy), noProxy...)}
+}
+
+// EnvVars returns the proxy variables, in upper case
+func (p ProxyConfig) EnvVars() []EnvVar {
+	return []EnvVar{
+		{Name: "HTTP_PROXY", Value: p.URL},
+		{Name: "HTTPS_PROXY", Value: p.URL},
+		{Name: "NO_PROXY", Value: strings.Join(p.NoProxy, ",")},
+	}
+}
+
+// Env returns the proxy variables as NAME=value, in upper and lower case as curl only reads http_proxy
+func (p ProxyConfig) Env() []string {
+	var env []string
+	for _, e := range p.EnvVars() {
+		env = append(env, e.Name+"="+e.Value, strings.ToLower(e.Name)+"="+e.Value)
+	}
+	return env
+}
+
+// RancherHelmFlags returns the proxy values of the Rancher chart
+func (p ProxyConfig) RancherHelmFlags() []string {
+	return []string{
+		"--set", "proxy=" + p.URL,
+		// helm splits --set values on commas
+		"--set", "noProxy=" + strings.Join(p.NoProxy, `\,`),
+	}
+}
+
+/**
+ * Patch the rancher-turtles entry of rancher-config with the proxy values of the chart
+ * Rancher reverts the changes made to the deployments of its system charts, so the proxy goes through the chart values.
+ * @returns The patch applied
+ */
+func (p ProxyConfig) PatchTurtlesConfig() (string, error) {
+	return patchTurtlesConfig(func(config *TurtlesConfig) {
+		config.Proxy = p.URL
+		config.NoProxy = strings.Join(p.NoProxy, ",")
+	})
+}
+
+// CheckDeploymentEnv returns an error until the containers of a deployment have the proxy variables
+func (p ProxyConfig) CheckDeploymentEnv(ns, name string) error {
+	for _, e := range p.EnvVars() {
+		out, err := kubectl.Run("get", "deployment/"+name, "--namespace", ns,
+			"-o", fmt.Sprintf(`jsonpath={.spec.template.spec.containers[*].env[?(@.name=="%s")].value}`, e.Name))
+		if err != nil {
+			return fmt.Errorf("getting %s/%s: %w: %s", ns, name, err, out)
+		}
+		if strings.TrimSpace(out) != e.Value {
+			return fmt.Errorf("%s of %s/%s is %q, expected %q", e.Name, ns, name, strings.TrimSpace(out), e.Value)
+		}
+	}
+	return nil
+}
+
+/**
+ * Set the proxy variables of the manager container of every CAPIProvider
+ * The operator owns the provider deployments, so the CAPIProviders are patched rather than the deployments.
+ * @returns The CAPIProviders patched, as namespace/name
+ */
+func (p ProxyConfig) PatchCAPIProviders() ([]string, error) {
+	out, err := kubectl.Run("get", CAPIProvidersResource, "--all-namespaces",
+		"-o", `jsonpath={range .items[*]}{.metadata.namespace}/{.metadata.name}{"\n"}{end}`)
+	if err != nil {
+		return nil, fmt.Errorf("listing CAPIProviders: %w: %s", err, out)
+	}
+	providers := strings.Fields(out)
+	for _, provider := range providers {
+		ns, name, _ := strings.Cut(provider, "/")
+		if err := p.patchCAPIProvider(ns, name); err != nil {
+			return providers, err
+		}
+	}
+	return providers, nil
+}
+
+// patchCAPIProvider sets the proxy variables of the manager container of a CAPIProvider
+func (p ProxyConfig) patchCAPIProvider(ns, name string) error {
+	out, err := kubectl.Run("get", CAPIProvidersResource, name, "--namespace", ns, "-o", "jsonpath={.spec.deployment.containers}")
+	if err != nil {
+		return fmt.Errorf("getting CAPIProvider %s/%s: %w: %s", ns, name, err, out)
+	}
+
+	// Keep the other fields of the containers, a merge patch replaces the whole list
+	var containers []map[string]any
+	if strings.TrimSpace(out) != "" {
+		if err := json.Unmarshal([]byte(out), &containers); err != nil {
+			return fmt.Errorf("CAPIProvider %s/%s containers: %w", ns, name, err)
+		}
+	}
+	i := slices.IndexFunc(containers, func(c map[string]any) bool { return c["name"] == "manager" })
+	if i < 0 {
+		containers = append(containers, map[string]any{"name": "manager"})
+		i = len(containers) - 1
+	}
+
+	var env []any
+	if existing, ok := containers[i]["env"].([]any); ok {
+		for _, e := range existing {
+			if v, ok := e.(map[string]any); ok && slices.Contains(proxyEnvNames, fmt.Sprint(v["name"])) {
+				continue
+			}
+			env = append(env, e)
+		}
+	}
+	for _, e := range p.EnvVars() {
+		env = append(env, map[string]string{"name": e.Name, "value": e.Value})
+	}
+	containers[i]["env"] = env
+
+	patch, err := json.Marshal(map[string]any{"spec": map[string]any{"deployment": map[string]any{"containers": containers}}})
+	if err != nil {
+		return err
+	}
+	if out, err := kubectl.Run("patch", CAPIProvidersResource, name, "--namespace", ns, "--type", "merge", "-p", string(patch)); err != nil {
+		return fmt.Errorf("patching CAPIProvider %s/%s: %w: %s", ns, name, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/components"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// CertManagerChart is the cert-manager chart installed from the jetstack repository
+	CertManagerChart = "jetstack/cert-manager"
+	certManagerRepo  = "https://charts.jetstack.io"
+)
+
+// TurtlesConfig is the rancher-turtles entry of the rancher-config configmap
+type TurtlesConfig struct {
+	Global struct {
+		Cattle struct {
+			SystemDefaultRegistry string `yaml:"systemDefaultRegistry"`
+		} `yaml:"cattle"`
+	} `yaml:"global"`
+	Image struct {
+		Repository string `yaml:"repository"`
+	} `yaml:"image"`
+	Proxy   string `yaml:"proxy,omitempty"`
+	NoProxy string `yaml:"noProxy,omitempty"`
+	// Preserve any other fields from existing data (e.g., features)
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+/**
+ * Install cert-manager and wait for it
+ * @param chart Chart to install, CertManagerChart or a local archive for airgapped installs
+ * @param extraFlags Extra helm flags, e.g. image repository overrides
+ * @returns The helm output
+ */
+func InstallCertManager(chart string, extraFlags ...string) (string, error) {
+	var output strings.Builder
+	if chart == CertManagerChart {
+		for _, args := range [][]string{{"repo", "add", "jetstack", certManagerRepo}, {"repo", "update"}} {
+			out, err := RunHelmWithRetry(args...)
+			output.WriteString(out)
+			if err != nil {
+				return output.String(), err
+			}
+		}
+	}
+
+	flags := []string{
+		"upgrade", "--install", "cert-manager", chart,
+		"--namespace", "cert-manager",
+		"--create-namespace",
+		"--set", "crds.enabled=true",
+		"--wait", "--wait-for-jobs",
+	}
+	out, err := RunHelmWithRetry(append(flags, extraFlags...)...)
+	output.WriteString(out)
+	if err != nil {
+		return output.String(), err
+	}
+
+	err = WaitForDeployments([]Deployment{{"cert-manager", "cert-manager"}})
+	return output.String(), err
+}
+
+/**
+ * Patch the rancher-turtles entry of rancher-config to use the devel turtles image
+ * Turtles chart in Rancher always uses [sdr/]rancher/turtles image regardless of what is written in chart's values.yaml,
+ * so patch as early as possible for the system-chart controller to reconcile with the desired image.
+ * @param controllerImage Devel turtles image, e.g. ghcr.io/rancher/turtles-e2e
+ * @param systemDefaultRegistry Registry the image is pulled from, empty for the image registry
+ * @returns The patch applied
+ */
+func PatchTurtlesConfig(controllerImage, systemDefaultRegistry string) (string, error) {
+	return patchTurtlesConfig(func(config *TurtlesConfig) {
+		// The chart prefixes the repository with the system default registry
+		config.Global.Cattle.SystemDefaultRegistry = systemDefaultRegistry
+		config.Image.Repository = controllerImage
+		if systemDefaultRegistry != "" {
+			config.Image.Repository = components.StripRegistry(controllerImage)
+		}
+	})
+}
+
+// patchTurtlesConfig updates the rancher-turtles entry of rancher-config, keeping the fields update leaves alone
+func patchTurtlesConfig(update func(*TurtlesConfig)) (string, error) {
+	if out, err := kubectl.Run("wait", "--namespace", "cattle-system", "--for=create", "configmap/rancher-config", "--timeout=300s"); err != nil {
+		return "", fmt.Errorf("waiting for rancher-config: %w: %s", err, out)
+	}
+
+	// Parse existing YAML to preserve all fields (features, etc.)
+	config := &TurtlesConfig{}
+	existingRancherTurtlesConfig, err := kubectl.Run("get", "configmap", "rancher-config", "-n", "cattle-system", "-o", "jsonpath={.data['rancher-turtles']}")
+	if err != nil {
+		return "", err
+	}
+	if existingRancherTurtlesConfig != "" {
+		if err := yaml.Unmarshal([]byte(existingRancherTurtlesConfig), config); err != nil {
+			return "", err
+		}
+	}
+
+	// Update only the fields we control
+	update(config)
+
+	// Make YAML from the updated config structure
+	combinedRancherTurtlesConfig, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	// Make JSON for kubectl patch command (JSON with YAML string inside)
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"data": map[string]string{
+			"rancher-turtles": string(combinedRancherTurtlesConfig),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	status, err := kubectl.Run("patch", "configmap", "rancher-config", "-n", "cattle-system", "--type", "merge", "-p", string(patchBytes))
+	if err != nil || !strings.Contains(status, "patched") {
+		return string(patchBytes), fmt.Errorf("patching rancher-config failed: %v: %s", err, status)
+	}
+	return string(patchBytes), nil
+}
+
+/**
+ * Query a Rancher endpoint
+ * Rancher is installed with its self-signed certificate, so the certificate is not verified
+ * @param hostname Rancher hostname
+ * @param path Path of the endpoint, e.g. /ping
+ * @returns HTTP status code and body
+ */
+func RancherGet(hostname, path string) (int, string, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // #nosec G402 -- self-signed test certificate
+		},
+	}
+	resp, err := client.Get("https://" + hostname + path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
+
+// WaitForRancherPing waits for Rancher /ping to answer pong
+func WaitForRancherPing(hostname string, timeout time.Duration) error {
+	return Retry(timeout, 10*time.Second, func() error {
+		code, body, err := RancherGet(hostname, "/ping")
+		if err != nil {
+			return err
+		}
+		if code != http.StatusOK || strings.TrimSpace(body) != "pong" {
+			return fmt.Errorf("/ping returned HTTP %d: %s", code, body)
+		}
+		return nil
+	})
+}
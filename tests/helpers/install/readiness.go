@@ -0,0 +1,167 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+)
+
+// SystemChart is a helm release Rancher deploys as a system chart
+type SystemChart struct {
+	Namespace string
+	Release   string
+	Setting   string // Rancher setting holding the chart version Rancher deploys, empty if there is none
+}
+
+// RancherSystemCharts returns the system charts Rancher deploys, Turtles from 2.13 onwards
+func RancherSystemCharts(withTurtles bool) []SystemChart {
+	charts := []SystemChart{
+		{"cattle-system", "rancher-webhook", "rancher-webhook-version"},
+		{"cattle-fleet-system", "fleet", "fleet-version"},
+	}
+	if withTurtles {
+		charts = append(charts, SystemChart{"cattle-turtles-system", TurtlesSystemChart, ""})
+	}
+	return charts
+}
+
+// RancherSetting returns the value of a Rancher setting, its default when not set
+func RancherSetting(name string) (string, error) {
+	out, err := kubectl.Run("get", "settings.management.cattle.io", name, "-o", "jsonpath={.value}/{.default}")
+	if err != nil {
+		return "", fmt.Errorf("reading setting %s: %w: %s", name, err, out)
+	}
+	value, def, _ := strings.Cut(strings.TrimSpace(out), "/")
+	if value == "" {
+		return def, nil
+	}
+	return value, nil
+}
+
+// CAPICRDs returns the names of the CAPI and Turtles CRDs
+func CAPICRDs() ([]string, error) {
+	out, err := kubectl.Run("get", "crd", "-o", `jsonpath={range .items[*]}{.metadata.name}{"\n"}{end}`)
+	if err != nil {
+		return nil, fmt.Errorf("listing CRDs: %w: %s", err, out)
+	}
+	var crds []string
+	for _, name := range strings.Fields(out) {
+		if strings.HasSuffix(name, ".cluster.x-k8s.io") || strings.HasSuffix(name, ".turtles-capi.cattle.io") {
+			crds = append(crds, name)
+		}
+	}
+	return crds, nil
+}
+
+// ReadinessCheck is one of the checks telling Rancher is usable, the caller retries it until it succeeds
+type ReadinessCheck struct {
+	Name string
+	Run  func() error
+}
+
+/**
+ * List the checks telling Rancher Manager is actually usable, not only Available
+ * @param hostname Rancher hostname
+ * @param withTurtles Rancher deploys Turtles and CAPI, i.e. Rancher >= 2.13
+ * @param expectedVersions Expected system chart versions by chart name, the other charts are checked against their Rancher setting
+ * @returns The checks, in the order they have to pass
+ */
+func RancherReadinessChecks(hostname string, withTurtles bool, expectedVersions map[string]string) []ReadinessCheck {
+	checks := []ReadinessCheck{
+		{"Rancher /ping answers", func() error {
+			code, body, err := RancherGet(hostname, "/ping")
+			if err == nil && (code != http.StatusOK || strings.TrimSpace(body) != "pong") {
+				err = fmt.Errorf("/ping returned HTTP %d: %s", code, body)
+			}
+			return err
+		}},
+		{"Rancher /v3 API is served", func() error {
+			// Anonymous requests are rejected, but only once the API is up
+			code, _, err := RancherGet(hostname, "/v3")
+			if err == nil && code != http.StatusOK && code != http.StatusUnauthorized {
+				err = fmt.Errorf("/v3 returned HTTP %d", code)
+			}
+			return err
+		}},
+		{"the certificate served by Rancher is trusted with its cacerts", func() error {
+			cacerts, err := RancherCACerts()
+			if err != nil {
+				return err
+			}
+			return VerifyRancherChain(hostname, cacerts)
+		}},
+		{"the local cluster is Active", func() error {
+			out, err := kubectl.Run("get", "clusters.management.cattle.io", "local",
+				"-o", `jsonpath={.status.conditions[?(@.type=="Ready")].status}`)
+			if err == nil && strings.TrimSpace(out) != "True" {
+				err = fmt.Errorf("local cluster Ready condition is %q", out)
+			}
+			return err
+		}},
+	}
+
+	for _, c := range RancherSystemCharts(withTurtles) {
+		checks = append(checks, ReadinessCheck{fmt.Sprintf("system chart %s/%s is deployed", c.Namespace, c.Release), func() error {
+			return checkSystemChart(c, expectedVersions[c.Release])
+		}})
+	}
+
+	if withTurtles {
+		checks = append(checks, ReadinessCheck{"CAPI CRDs are Established", func() error {
+			crds, err := CAPICRDs()
+			if err != nil {
+				return err
+			}
+			if len(crds) == 0 {
+				return errors.New("no CAPI CRDs found")
+			}
+			for _, crd := range crds {
+				if out, err := kubectl.Run("wait", "crd/"+crd, "--for=condition=Established", "--timeout=10s"); err != nil {
+					return fmt.Errorf("CRD %s is not Established: %w: %s", crd, err, out)
+				}
+			}
+			return nil
+		}})
+	}
+	return checks
+}
+
+// checkSystemChart checks a system chart is deployed at the expected version, the one of its setting when empty
+func checkSystemChart(c SystemChart, version string) error {
+	if version == "" && c.Setting != "" {
+		var err error
+		if version, err = RancherSetting(c.Setting); err != nil {
+			return err
+		}
+	}
+
+	r, err := HelmRelease(c.Namespace, c.Release)
+	if err != nil {
+		return err
+	}
+	if !r.Deployed() {
+		return fmt.Errorf("release %s/%s is not deployed", c.Namespace, c.Release)
+	}
+	// Rancher may reconcile the chart again after an upgrade, so the version is waited for too
+	if version != "" && r.Chart != c.Release+"-"+version {
+		return fmt.Errorf("release %s/%s is %s, expected version %s", c.Namespace, c.Release, r.Chart, version)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+	"gopkg.in/yaml.v3"
+)
+
+// Install steps recorded in the state file
+const (
+	StepK3s         = "k3s"
+	StepCertManager = "cert-manager"
+	StepRancher     = "rancher"
+)
+
+// DefaultStateFile is where the install progress is recorded when no other file is given
+var DefaultStateFile = filepath.Join(os.TempDir(), "turtles-e2e-install-state.yaml")
+
+// CompletedStep is an install step done, by this install or found already done on the host
+type CompletedStep struct {
+	Name  string    `yaml:"name"`
+	Found bool      `yaml:"found,omitempty"` // true when the step was skipped as already done
+	Time  time.Time `yaml:"time"`
+}
+
+// State is the progress of an install, persisted so that an interrupted install can be resumed
+type State struct {
+	path     string
+	previous []CompletedStep   // steps recorded by the run resumed
+	Config   map[string]string `yaml:"config"`
+	Steps    []CompletedStep   `yaml:"steps"`
+}
+
+// StateSettings are the settings an install depends on, shared by the CLI and the Ginkgo install spec
+type StateSettings struct {
+	RancherVersion        string
+	Hostname              string
+	TLSMode               string
+	TurtlesDevChart       bool
+	ControllerImage       string
+	SystemDefaultRegistry string
+	SystemChartOverrides  string
+	ProxyURL              string
+}
+
+// Config returns the config of the state file, keyed by the environment variables of the settings
+func (s StateSettings) Config() map[string]string {
+	tlsMode := s.TLSMode
+	if tlsMode == "" {
+		tlsMode = TLSRancher
+	}
+	return map[string]string{
+		"K3S_INSTALLER_VERSION":  K3sInstallerVersion,
+		"CERT_MANAGER_CHART":     CertManagerChart,
+		"RANCHER_VERSION":        s.RancherVersion,
+		"PUBLIC_DNS":             s.Hostname,
+		"RANCHER_TLS_MODE":       tlsMode,
+		"TURTLES_DEV_CHART":      strconv.FormatBool(s.TurtlesDevChart),
+		"CONTROLLER_IMG":         s.ControllerImage,
+		"AIRGAP_REGISTRY":        s.SystemDefaultRegistry,
+		"SYSTEM_CHART_OVERRIDES": s.SystemChartOverrides,
+		"PROXY_URL":              s.ProxyURL,
+	}
+}
+
+/**
+ * Load the install progress, or start a new one when the file does not exist
+ * Resuming with another config would mix two installs, so it is refused.
+ * @param path State file
+ * @param config Settings the install depends on, e.g. RANCHER_VERSION
+ * @returns The install state, saved to path as steps complete
+ */
+func LoadState(path string, config map[string]string) (*State, error) {
+	s := &State{path: path, Config: config}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved State
+	if err := yaml.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("install state %s: %w", path, err)
+	}
+	var changed []string
+	for k := range mergeKeys(config, saved.Config) {
+		if config[k] != saved.Config[k] {
+			changed = append(changed, k)
+		}
+	}
+	if len(changed) > 0 {
+		slices.Sort(changed)
+		return nil, fmt.Errorf("install state %s was recorded with another config (%s changed), resume with the same config or remove it to start over",
+			path, strings.Join(changed, ", "))
+	}
+	s.Steps = saved.Steps
+	s.previous = slices.Clone(saved.Steps)
+	return s, nil
+}
+
+func mergeKeys(maps ...map[string]string) map[string]struct{} {
+	keys := map[string]struct{}{}
+	for _, m := range maps {
+		for k := range m {
+			keys[k] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// Done returns true if the step was completed by a previous run
+func (s *State) Done(step string) bool {
+	return s != nil && slices.ContainsFunc(s.previous, func(c CompletedStep) bool { return c.Name == step })
+}
+
+/**
+ * Describe what Run did with a step of a resumed install
+ * @param step Step name
+ * @param applied Result of Run
+ * @returns Why the step was skipped or applied again, empty for a step applied for the first time
+ */
+func (s *State) Outcome(step string, applied bool) string {
+	switch {
+	case !applied && s.Done(step):
+		return fmt.Sprintf("Step %s done by a previous run and still found on the host, skipped", step)
+	case !applied:
+		return fmt.Sprintf("Step %s found already done on the host, skipped", step)
+	case s.Done(step):
+		return fmt.Sprintf("Step %s done by a previous run was undone since, applied again", step)
+	}
+	return ""
+}
+
+/**
+ * Run a step unless it is already done on the host, then record it
+ * The host is always checked, a step recorded by a previous run is applied again if it was undone since.
+ * A nil state runs the step without checking nor recording it, e.g. on upgrade.
+ * @param step Step name, e.g. StepK3s
+ * @param found Checks if the step is already done
+ * @param apply Does the step, it must converge when partially done
+ * @returns true if the step was applied, false if it was found done
+ */
+func (s *State) Run(step string, found func() (bool, error), apply func() error) (bool, error) {
+	if s == nil {
+		return true, apply()
+	}
+
+	done, err := found()
+	if err != nil {
+		return false, fmt.Errorf("checking step %s: %w", step, err)
+	}
+	if !done {
+		if err := apply(); err != nil {
+			return true, err
+		}
+	}
+	return !done, s.complete(step, done)
+}
+
+// complete records a step and saves the state
+func (s *State) complete(step string, found bool) error {
+	s.Steps = slices.DeleteFunc(s.Steps, func(c CompletedStep) bool { return c.Name == step })
+	s.Steps = append(s.Steps, CompletedStep{Name: step, Found: found, Time: time.Now().UTC()})
+
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	// Through a rename, an interrupted write must not lose the progress
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// K3sRunning returns true if the K3s service is active and its kubeconfig written
+func K3sRunning() bool {
+	if err := exec.Command("systemctl", "is-active", "--quiet", "k3s").Run(); err != nil {
+		return false
+	}
+	_, err := os.Stat(K3sKubeconfig)
+	return err == nil
+}
+
+// Release is a helm release as listed by helm
+type Release struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Status     string `json:"status"`
+	Chart      string `json:"chart"` // chart name and version, e.g. rancher-2.14.1
+	AppVersion string `json:"app_version"`
+}
+
+// Deployed returns true if the last revision of the release is deployed
+func (r *Release) Deployed() bool {
+	return r != nil && r.Status == "deployed"
+}
+
+// HelmRelease returns a release, nil if it does not exist
+func HelmRelease(ns, name string) (*Release, error) {
+	out, err := kubectl.RunHelmBinaryWithOutput("list", "--namespace", ns, "--all", "--filter", "^"+name+"$", "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("helm list -n %s: %w: %s", ns, err, out)
+	}
+	var releases []Release
+	if err := json.Unmarshal([]byte(out), &releases); err != nil {
+		return nil, fmt.Errorf("helm list -n %s: %w", ns, err)
+	}
+	if len(releases) == 0 {
+		return nil, nil
+	}
+	return &releases[0], nil
+}
+
+// CertManagerDeployed returns true if the cert-manager release is deployed
+func CertManagerDeployed() (bool, error) {
+	release, err := HelmRelease("cert-manager", "cert-manager")
+	return release.Deployed(), err
+}
+
+/**
+ * Check if Rancher is deployed at the version of RANCHER_VERSION
+ * @param rancherVersion Rancher channel and version, e.g. prime/2.14.1 or head/2.14, where 2.14 matches any 2.14 build
+ * @returns true if the rancher release is deployed with a matching chart version
+ */
+func RancherDeployed(rancherVersion string) (bool, error) {
+	release, err := HelmRelease("cattle-system", "rancher")
+	if err != nil || !release.Deployed() {
+		return false, err
+	}
+	parts := strings.Split(rancherVersion, "/")
+	version := strings.TrimPrefix(parts[len(parts)-1], "v")
+	chartVersion := strings.TrimPrefix(release.Chart, "rancher-")
+	return chartVersion == version || strings.HasPrefix(chartVersion, version+".") || strings.HasPrefix(chartVersion, version+"-"), nil
+}
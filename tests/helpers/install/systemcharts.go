@@ -0,0 +1,192 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SystemChartsGitPort is the default port of the git server holding the dev system charts
+	SystemChartsGitPort = "4080"
+	// TurtlesChartDevVersion is the default version of the dev rancher-turtles system chart
+	TurtlesChartDevVersion = "108.0.0+up99.99.99"
+	// TurtlesSystemChart is the name of the Turtles system chart
+	TurtlesSystemChart = "rancher-turtles"
+)
+
+// SystemChartOverride pins one Rancher system chart to a given version
+type SystemChartOverride struct {
+	Chart   string // system chart name, e.g. rancher-turtles, rancher-webhook or fleet
+	Version string // chart version Rancher has to install
+}
+
+// EnvName returns the Rancher setting environment variable holding the chart version,
+// e.g. CATTLE_RANCHER_TURTLES_VERSION for rancher-turtles
+func (o SystemChartOverride) EnvName() string {
+	return "CATTLE_" + strings.ToUpper(strings.ReplaceAll(o.Chart, "-", "_")) + "_VERSION"
+}
+
+// ParseSystemChartOverrides parses chart=version entries separated by commas, as in SYSTEM_CHART_OVERRIDES
+func ParseSystemChartOverrides(s string) ([]SystemChartOverride, error) {
+	var overrides []SystemChartOverride
+	for _, o := range strings.Split(s, ",") {
+		if strings.TrimSpace(o) == "" {
+			continue
+		}
+		chart, version, found := strings.Cut(strings.TrimSpace(o), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid system chart override %q, expected chart=version", o)
+		}
+		overrides = append(overrides, SystemChartOverride{Chart: chart, Version: version})
+	}
+	return overrides, nil
+}
+
+// SystemChartsConfig points Rancher to a custom system charts repository
+type SystemChartsConfig struct {
+	RepoURL   string // git repository holding the system charts
+	Branch    string // branch of the repository
+	Overrides []SystemChartOverride
+}
+
+// EnvVar is an environment variable of the rancher container
+type EnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// Set adds an override, replacing any existing one for the same chart
+func (c *SystemChartsConfig) Set(override SystemChartOverride) {
+	for i, o := range c.Overrides {
+		if o.Chart == override.Chart {
+			c.Overrides[i] = override
+			return
+		}
+	}
+	c.Overrides = append(c.Overrides, override)
+}
+
+// DevSystemChartsGitPort returns the port of the git server holding the dev system charts, the one of the chart
+// server when it serves the git repositories of chartServerGitRoot, SystemChartsGitPort otherwise
+func DevSystemChartsGitPort(chartServerPort, chartServerGitRoot string) string {
+	if chartServerPort != "" && chartServerGitRoot != "" {
+		return chartServerPort
+	}
+	return SystemChartsGitPort
+}
+
+/**
+ * Point Rancher to the dev Turtles chart, only available from the local system charts repository
+ * The repository and branch are kept when already set.
+ * @param hostname Host serving the system charts git repository, i.e. the Rancher host
+ * @param gitPort Port of the git server, SystemChartsGitPort when empty
+ * @param rancherPointVersion Rancher point version, the dev charts are on the dev-v<point version> branch
+ * @param chartVersion Version of the dev chart, TurtlesChartDevVersion when empty
+ */
+func (c *SystemChartsConfig) UseDevTurtles(hostname, gitPort, rancherPointVersion, chartVersion string) {
+	if gitPort == "" {
+		gitPort = SystemChartsGitPort
+	}
+	if chartVersion == "" {
+		chartVersion = TurtlesChartDevVersion
+	}
+	if c.RepoURL == "" {
+		c.RepoURL = "http://" + hostname + ":" + gitPort + "/git/charts"
+	}
+	if c.Branch == "" {
+		c.Branch = "dev-v" + rancherPointVersion
+	}
+	c.Set(SystemChartOverride{Chart: TurtlesSystemChart, Version: chartVersion})
+}
+
+// Env returns the Rancher environment variables for this configuration
+func (c SystemChartsConfig) Env() []EnvVar {
+	var env []EnvVar
+	if c.RepoURL != "" {
+		env = append(env, EnvVar{"CATTLE_CHART_DEFAULT_URL", c.RepoURL})
+	}
+	if c.Branch != "" {
+		env = append(env, EnvVar{"CATTLE_CHART_DEFAULT_BRANCH", c.Branch})
+	}
+	for _, o := range c.Overrides {
+		env = append(env, EnvVar{o.EnvName(), o.Version})
+	}
+	return env
+}
+
+/**
+ * Build the helm flags injecting the system charts configuration in the Rancher deployment
+ * The env vars are merged by name into the rancher container with a kustomize post-renderer,
+ * so they never collide with the extraEnv entries set by ele-testhelpers.
+ * @param dir Directory where to write the post-renderer files
+ * @returns Flags to pass to helm
+ */
+func (c SystemChartsConfig) HelmFlags(dir string) ([]string, error) {
+	patch := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]string{"name": "rancher"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []map[string]interface{}{
+						{"name": "rancher", "env": c.Env()},
+					},
+				},
+			},
+		},
+	}
+	patchData, err := yaml.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	kustomization := `resources:
+- all.yaml
+patches:
+- path: rancher-env.yaml
+  target:
+    kind: Deployment
+    name: rancher
+`
+	renderer := fmt.Sprintf(`#!/bin/sh
+set -e
+cat > %[1]s/all.yaml
+kubectl kustomize %[1]s
+`, dir)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for file, content := range map[string][]byte{
+		"rancher-env.yaml":   patchData,
+		"kustomization.yaml": []byte(kustomization),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), content, 0644); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "post-renderer.sh"), []byte(renderer), 0755); err != nil {
+		return nil, err
+	}
+
+	return []string{"--post-renderer", filepath.Join(dir, "post-renderer.sh")}, nil
+}
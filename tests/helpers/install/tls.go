@@ -0,0 +1,308 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher-sandbox/ele-testhelpers/kubectl"
+)
+
+// Rancher TLS modes, how the certificate served by Rancher is issued
+const (
+	TLSRancher     = "rancher"     // self-signed by Rancher through cert-manager, the default
+	TLSPrivateCA   = "private-ca"  // signed by a CA generated by the suite, with privateCA=true
+	TLSLetsEncrypt = "letsencrypt" // issued by Let's Encrypt through cert-manager
+)
+
+const (
+	// RancherTLSSecret is the secret holding the Rancher certificate when it is not issued by cert-manager
+	RancherTLSSecret = "tls-rancher-ingress"
+	// RancherCASecret is the secret holding the private CA Rancher hands to its agents
+	RancherCASecret = "tls-ca"
+
+	// LetsEncryptStagingRootsURL are the roots of the Let's Encrypt staging environment, not trusted by any system
+	LetsEncryptStagingRootsURL = "https://letsencrypt.org/certs/staging/letsencrypt-stg-root-x1.pem"
+)
+
+// RancherTLS is the TLS configuration of Rancher
+type RancherTLS struct {
+	Mode string
+	// Let's Encrypt account email and environment (staging or production)
+	LetsEncryptEmail       string
+	LetsEncryptEnvironment string
+	// Fetch downloads the Let's Encrypt staging roots
+	Fetch func(url string) ([]byte, error)
+}
+
+// Validate checks the mode and its options
+func (t RancherTLS) Validate() error {
+	switch t.Mode {
+	case "", TLSRancher, TLSPrivateCA:
+		return nil
+	case TLSLetsEncrypt:
+		if t.LetsEncryptEmail == "" {
+			return errors.New("an email is required for the Let's Encrypt account")
+		}
+		if env := t.LetsEncryptEnvironment; env != "" && env != "staging" && env != "production" {
+			return fmt.Errorf("unknown Let's Encrypt environment %q, expected staging or production", env)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown Rancher TLS mode %q, expected %s, %s or %s", t.Mode, TLSRancher, TLSPrivateCA, TLSLetsEncrypt)
+}
+
+/**
+ * Create the secrets the TLS mode needs before installing or upgrading Rancher
+ * The private CA is generated once, upgrades keep it for the agents to keep trusting Rancher.
+ * @param hostname Rancher hostname
+ * @returns The helm flags of the TLS mode, to pass on install and upgrade
+ */
+func (t RancherTLS) Prepare(hostname string) ([]string, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch t.Mode {
+	case TLSPrivateCA:
+		exists, err := secretExists("cattle-system", RancherCASecret)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			ca, err := NewPrivateCA(hostname)
+			if err != nil {
+				return nil, err
+			}
+			err = applySecrets(
+				secret(RancherTLSSecret, "kubernetes.io/tls", map[string][]byte{"tls.crt": ca.Cert, "tls.key": ca.Key}),
+				secret(RancherCASecret, "Opaque", map[string][]byte{"cacerts.pem": ca.CACert}),
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return []string{"--set", "ingress.tls.source=secret", "--set", "privateCA=true"}, nil
+
+	case TLSLetsEncrypt:
+		env := t.LetsEncryptEnvironment
+		if env == "" {
+			env = "staging"
+		}
+		flags := []string{
+			"--set", "ingress.tls.source=letsEncrypt",
+			"--set", "letsEncrypt.email=" + t.LetsEncryptEmail,
+			"--set", "letsEncrypt.environment=" + env,
+			"--set", "letsEncrypt.ingress.class=traefik",
+		}
+		if env == "production" {
+			return flags, nil
+		}
+		// Agents only trust the staging chain through the private CA
+		if t.Fetch == nil {
+			return nil, errors.New("no fetcher to download the Let's Encrypt staging roots")
+		}
+		roots, err := t.Fetch(LetsEncryptStagingRootsURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := applySecrets(secret(RancherCASecret, "Opaque", map[string][]byte{"cacerts.pem": roots})); err != nil {
+			return nil, err
+		}
+		return append(flags, "--set", "privateCA=true"), nil
+	}
+	return []string{"--set", "ingress.tls.source=rancher"}, nil
+}
+
+// PrivateCA is a CA and the Rancher certificate it signed, PEM encoded
+type PrivateCA struct {
+	CACert []byte
+	Cert   []byte
+	Key    []byte
+}
+
+/**
+ * Generate a CA and a certificate signed by it for Rancher
+ * @param hostname Rancher hostname, or IP address
+ * @returns The CA certificate, the Rancher certificate and its key
+ */
+func NewPrivateCA(hostname string) (*PrivateCA, error) {
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(now.UnixNano()),
+		Subject:               pkix.Name{CommonName: "turtles-e2e private CA", Organization: []string{"Rancher Turtles e2e"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano() + 1),
+		Subject:      pkix.Name{CommonName: hostname},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(hostname); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{hostname}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrivateCA{
+		CACert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		Cert:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:    pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+func secretExists(ns, name string) (bool, error) {
+	out, err := kubectl.Run("get", "secret", name, "--namespace", ns, "--ignore-not-found", "-o", "name")
+	if err != nil {
+		return false, fmt.Errorf("getting secret %s/%s: %w: %s", ns, name, err, out)
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+// secret returns a cattle-system secret manifest, kubectl reads JSON manifests as YAML
+func secret(name, secretType string, data map[string][]byte) map[string]any {
+	return map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]string{"name": name, "namespace": "cattle-system"},
+		"type":       secretType,
+		"data":       data, // base64 encoded by json.Marshal
+	}
+}
+
+// applySecrets creates the cattle-system namespace, if needed, and applies the secrets
+func applySecrets(secrets ...map[string]any) error {
+	_, _ = kubectl.Run("create", "namespace", "cattle-system")
+
+	f, err := os.CreateTemp("", "rancher-tls-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = json.NewEncoder(f).Encode(map[string]any{"apiVersion": "v1", "kind": "List", "items": secrets})
+	if err := errors.Join(err, f.Close()); err != nil {
+		return err
+	}
+	if out, err := kubectl.Run("apply", "-f", f.Name()); err != nil {
+		return fmt.Errorf("applying the Rancher TLS secrets: %w: %s", err, out)
+	}
+	return nil
+}
+
+// RancherCACerts returns the cacerts setting Rancher hands to its agents, empty for publicly trusted certificates
+func RancherCACerts() (string, error) {
+	out, err := kubectl.Run("get", "settings.management.cattle.io", "cacerts", "-o", "jsonpath={.value}")
+	if err != nil {
+		return "", fmt.Errorf("getting the cacerts setting: %w: %s", err, out)
+	}
+	return out, nil
+}
+
+// CAChecksum returns the CATTLE_CA_CHECKSUM of the agents for a cacerts setting, computed like Rancher does
+func CAChecksum(cacerts string) string {
+	if strings.TrimSpace(cacerts) == "" {
+		return ""
+	}
+	if !strings.HasSuffix(cacerts, "\n") {
+		cacerts += "\n"
+	}
+	sum := sha256.Sum256([]byte(cacerts))
+	return hex.EncodeToString(sum[:])
+}
+
+/**
+ * Verify the chain served by Rancher against its cacerts setting, as an agent does
+ * @param hostname Rancher hostname
+ * @param cacerts cacerts setting, the system roots are used when empty
+ * @returns Error when the chain is not trusted or not valid for hostname
+ */
+func VerifyRancherChain(hostname, cacerts string) error {
+	// Certificates are verified below, against the CA of the agents
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", net.JoinHostPort(hostname, "443"),
+		&tls.Config{InsecureSkipVerify: true, ServerName: hostname}) // #nosec G402
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	chain := conn.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return fmt.Errorf("no certificate served by %s", hostname)
+	}
+	opts := x509.VerifyOptions{DNSName: hostname, Intermediates: x509.NewCertPool()}
+	for _, cert := range chain[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if strings.TrimSpace(cacerts) != "" {
+		opts.Roots = x509.NewCertPool()
+		if !opts.Roots.AppendCertsFromPEM([]byte(cacerts)) {
+			return errors.New("no certificate found in the cacerts setting")
+		}
+	}
+	if _, err := chain[0].Verify(opts); err != nil {
+		return fmt.Errorf("certificate of %s (issued by %q): %w", hostname, chain[0].Issuer.CommonName, err)
+	}
+	return nil
+}
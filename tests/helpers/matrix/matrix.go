@@ -0,0 +1,226 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package matrix loads the version compatibility matrix (assets/compatibility-matrix.yaml):
+// the Kubernetes, provider and ClusterClass versions the tests use for each Rancher minor.
+package matrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SchemaVersion is the only matrix schema version supported
+	SchemaVersion = 1
+	// DefaultRelease is the entry used for the Rancher minors not listed
+	DefaultRelease = "default"
+)
+
+// Matrix is the compatibility matrix
+type Matrix struct {
+	SchemaVersion   int                        `yaml:"schemaVersion" json:"schemaVersion"`
+	Releases        map[string]Release         `yaml:"releases" json:"releases"`
+	ProviderSupport map[string]ProviderSupport `yaml:"providerSupport" json:"providerSupport"`
+}
+
+// Release holds the versions used for a Rancher minor
+type Release struct {
+	ClassBranch string            `yaml:"classBranch" json:"classBranch"`
+	Kubernetes  Kubernetes        `yaml:"kubernetes" json:"kubernetes"`
+	Providers   map[string]string `yaml:"providers" json:"providers"` // provider version by config-prime.yaml name
+}
+
+// Kubernetes holds the Kubernetes versions of the provisioned clusters
+type Kubernetes struct {
+	Kind       string `yaml:"kind" json:"kind"`
+	Kubeadm    string `yaml:"kubeadm" json:"kubeadm"`
+	RKE2       string `yaml:"rke2" json:"rke2"`
+	V2ProvRKE2 string `yaml:"v2provRKE2" json:"v2provRKE2"`
+	EKS        string `yaml:"eks" json:"eks"`
+	AKS        string `yaml:"aks" json:"aks"`
+}
+
+// Get returns a version by its matrix key, e.g. kind or eks
+func (k Kubernetes) Get(key string) (string, bool) {
+	versions := map[string]string{
+		"kind":       k.Kind,
+		"kubeadm":    k.Kubeadm,
+		"rke2":       k.RKE2,
+		"v2provRKE2": k.V2ProvRKE2,
+		"eks":        k.EKS,
+		"aks":        k.AKS,
+	}
+	v, found := versions[key]
+	return v, found
+}
+
+// ProviderSupport lists the Kubernetes versions each provider minor supports
+type ProviderSupport struct {
+	Kubernetes []string          `yaml:"kubernetes" json:"kubernetes"` // Kubernetes keys checked for this provider
+	Versions   map[string]string `yaml:"versions" json:"versions"`     // semver constraint by provider minor, e.g. v1.10
+}
+
+// Load reads and validates a matrix file
+func Load(path string) (*Matrix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Matrix{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (m *Matrix) validate() error {
+	if m.SchemaVersion != SchemaVersion {
+		return fmt.Errorf("unsupported schemaVersion %d, expected %d", m.SchemaVersion, SchemaVersion)
+	}
+	if _, found := m.Releases[DefaultRelease]; !found {
+		return fmt.Errorf("missing %q release", DefaultRelease)
+	}
+
+	var errs []error
+	for name, r := range m.Releases {
+		if name != DefaultRelease {
+			if _, err := semver.NewVersion(name); err != nil {
+				errs = append(errs, fmt.Errorf("release %q is not a Rancher minor: %w", name, err))
+			}
+		}
+		if r.ClassBranch == "" {
+			errs = append(errs, fmt.Errorf("release %q has no classBranch", name))
+		}
+		for _, key := range []string{"kind", "kubeadm", "rke2", "v2provRKE2", "eks", "aks"} {
+			v, _ := r.Kubernetes.Get(key)
+			if _, err := semver.NewVersion(v); err != nil {
+				errs = append(errs, fmt.Errorf("release %q has an invalid %s version %q", name, key, v))
+			}
+		}
+		for p, v := range r.Providers {
+			if _, err := semver.NewVersion(v); err != nil {
+				errs = append(errs, fmt.Errorf("release %q has an invalid %s provider version %q", name, p, v))
+			}
+		}
+	}
+
+	for p, s := range m.ProviderSupport {
+		for _, key := range s.Kubernetes {
+			if _, found := (Kubernetes{}).Get(key); !found {
+				errs = append(errs, fmt.Errorf("provider %q checks unknown Kubernetes key %q", p, key))
+			}
+		}
+		for minor, c := range s.Versions {
+			if _, err := semver.NewConstraint(c); err != nil {
+				errs = append(errs, fmt.Errorf("provider %q %s has an invalid constraint %q: %w", p, minor, c, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Release returns the entry of a Rancher version (e.g. 2.14.1 or v2.14.0-rc1) and its key
+func (m *Matrix) Release(rancherVersion string) (string, Release, error) {
+	if rancherVersion != "" {
+		v, err := semver.NewVersion(rancherVersion)
+		if err != nil {
+			return "", Release{}, fmt.Errorf("invalid Rancher version %q: %w", rancherVersion, err)
+		}
+		minor := fmt.Sprintf("%d.%d", v.Major(), v.Minor())
+		if r, found := m.Releases[minor]; found {
+			return minor, r, nil
+		}
+	}
+	return DefaultRelease, m.Releases[DefaultRelease], nil
+}
+
+// CheckKubernetes checks the Kubernetes versions of a release against the provider versions,
+// e.g. the ones resolved from config-prime.yaml. Providers without support data are not checked.
+func (m *Matrix) CheckKubernetes(r Release, providerVersions map[string]string) []error {
+	var errs []error
+
+	providers := make([]string, 0, len(m.ProviderSupport))
+	for p := range m.ProviderSupport {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+
+	for _, p := range providers {
+		s := m.ProviderSupport[p]
+		pv, found := providerVersions[p]
+		if !found || pv == "" {
+			continue
+		}
+		v, err := semver.NewVersion(pv)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid provider version %q", p, pv))
+			continue
+		}
+		minor := fmt.Sprintf("v%d.%d", v.Major(), v.Minor())
+		constraint, found := s.Versions[minor]
+		if !found {
+			errs = append(errs, fmt.Errorf("%s %s: no Kubernetes support data in the matrix", p, pv))
+			continue
+		}
+		c, _ := semver.NewConstraint(constraint)
+
+		for _, key := range s.Kubernetes {
+			kv, _ := r.Kubernetes.Get(key)
+			k, err := semver.NewVersion(kv)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid Kubernetes version %q", key, kv))
+				continue
+			}
+			if !c.Check(k) {
+				errs = append(errs, fmt.Errorf("%s %s does not support %s Kubernetes %s (supported: %s)", p, pv, key, kv, constraint))
+			}
+		}
+	}
+	return errs
+}
+
+// JSON returns the matrix as indented JSON, the format consumed by Cypress
+func (m *Matrix) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// CAPIAPIVersion returns the newest cluster.x-k8s.io API version of the release, v1beta2 from CAPI v1.11 onwards
+func (r Release) CAPIAPIVersion() (string, error) {
+	v, err := semver.NewVersion(r.Providers["cluster-api"])
+	if err != nil {
+		return "", fmt.Errorf("invalid cluster-api provider version %q: %w", r.Providers["cluster-api"], err)
+	}
+	if v.LessThan(semver.MustParse("v1.11.0")) {
+		return "v1beta1", nil
+	}
+	return "v1beta2", nil
+}
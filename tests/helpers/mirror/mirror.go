@@ -0,0 +1,133 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mirror copies images and OCI artifacts to another registry, e.g. the local registry
+// of an airgapped install.
+package mirror
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/components"
+)
+
+// Image is an image or artifact to copy
+type Image struct {
+	Source      string
+	Destination string
+	Artifact    bool // OCI artifact (chart, component manifests), copied as is whatever the platform
+}
+
+// Destination returns the reference of an image in registry, keeping its repository path, e.g.
+// quay.io/jetstack/cert-manager-controller:v1.19.1 gives <registry>/jetstack/cert-manager-controller:v1.19.1
+func Destination(registry, ref string) string {
+	return registry + "/" + components.StripRegistry(ref)
+}
+
+// List is a set of images to copy, indexed by destination
+type List map[string]Image
+
+// Add adds an image from sourceRegistry, ref has no registry, e.g. rancher/turtles:v0.26.0
+func (l List) Add(sourceRegistry, ref, registry string, artifact bool) {
+	l.AddRef(sourceRegistry+"/"+ref, registry, artifact)
+}
+
+// AddRef adds an image by full reference, e.g. quay.io/jetstack/cert-manager-controller:v1.19.1
+func (l List) AddRef(ref, registry string, artifact bool) {
+	dst := Destination(registry, ref)
+	l[dst] = Image{Source: ref, Destination: dst, Artifact: artifact}
+}
+
+// Sorted returns the images sorted by destination
+func (l List) Sorted() []Image {
+	images := make([]Image, 0, len(l))
+	for _, i := range l {
+		images = append(images, i)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Destination < images[j].Destination })
+	return images
+}
+
+/**
+ * Copy images with a bounded number of workers, images already in the destination are skipped
+ * @param images Images to copy
+ * @param workers Number of parallel copies
+ * @param platform Platform of the images to copy, all of them when nil
+ * @param opts Options of the copies, e.g. authentication or crane.Insecure for a plain HTTP destination
+ * @returns One error per image not copied
+ */
+func Copy(images []Image, workers int, platform *v1.Platform, opts ...crane.Option) []error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	queue := make(chan Image)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if err := copyImage(i, platform, opts); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, i := range images {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+func copyImage(i Image, platform *v1.Platform, opts []crane.Option) error {
+	if _, err := crane.Head(i.Destination, opts...); err == nil {
+		return nil
+	}
+	if platform != nil && !i.Artifact {
+		opts = append(opts[:len(opts):len(opts)], crane.WithPlatform(platform))
+	}
+	if err := crane.Copy(i.Source, i.Destination, opts...); err != nil {
+		return fmt.Errorf("copying %s: %w", i.Source, err)
+	}
+	return nil
+}
+
+// ParseList reads an image list such as rancher-images.txt, one reference per line, # for comments
+func ParseList(data []byte) []string {
+	var refs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	return refs
+}
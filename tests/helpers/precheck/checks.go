@@ -0,0 +1,135 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// ErrSkipped is wrapped by the checks that do not apply, e.g. an image not released through config-prime.yaml
+var ErrSkipped = errors.New("skipped")
+
+// Status of a check
+type Status string
+
+const (
+	Passed  Status = "✅"
+	Failed  Status = "❌"
+	Skipped Status = "➖"
+)
+
+// Check is a verification of an artifact, Run returns nil when it passes
+type Check struct {
+	Artifact string
+	Name     string
+	Run      func() error
+}
+
+// Result is the outcome of a check, a check returning joined errors gives one result per error
+type Result struct {
+	Artifact string
+	Check    string
+	Status   Status
+	Detail   string
+}
+
+/**
+ * Run all the checks, whatever the number of failures
+ * @param checks Checks to run
+ * @param workers Number of checks run in parallel
+ * @returns The results, in the order of the checks
+ */
+func RunChecks(checks []Check, workers int) []Result {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([][]Result, len(checks))
+	var wg sync.WaitGroup
+	queue := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = runCheck(checks[i])
+			}
+		}()
+	}
+	for i := range checks {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	var all []Result
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	return all
+}
+
+func runCheck(c Check) (results []Result) {
+	defer func() {
+		// A check must not take the whole precheck down
+		if r := recover(); r != nil {
+			results = []Result{{Artifact: c.Artifact, Check: c.Name, Status: Failed, Detail: fmt.Sprintf("panic: %v", r)}}
+		}
+	}()
+
+	err := c.Run()
+	if err == nil {
+		return []Result{{Artifact: c.Artifact, Check: c.Name, Status: Passed}}
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, e := range errs {
+		status := Failed
+		if errors.Is(e, ErrSkipped) {
+			status = Skipped
+		}
+		results = append(results, Result{Artifact: c.Artifact, Check: c.Name, Status: status, Detail: e.Error()})
+	}
+	return results
+}
+
+// Failures returns the failed results
+func Failures(results []Result) []Result {
+	var failed []Result
+	for _, r := range results {
+		if r.Status == Failed {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// WriteTable writes the results as a table (artifact, check, status, detail)
+func WriteTable(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ARTIFACT\tCHECK\tSTATUS\tDETAIL")
+	for _, r := range results {
+		detail := strings.ReplaceAll(r.Detail, "\n", " ")
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Artifact, r.Check, r.Status, detail)
+	}
+	return tw.Flush()
+}
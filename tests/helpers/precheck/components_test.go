@@ -0,0 +1,46 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/precheck"
+)
+
+var _ = Describe("Component images", func() {
+	v := &precheck.Validation{
+		Registries: precheck.Registries{Prime: "registry.rancher.com", StgPrime: "stgregistry.suse.com", Community: "docker.io"},
+	}
+	mirrored := map[string]bool{
+		"rancher/cluster-api-aws-controller:v2.11.0": true,
+		"rancher/kube-rbac-proxy:v0.19.1":            true,
+	}
+
+	DescribeTable("tells why an image is not available in an airgapped install",
+		func(image, reason string) {
+			Expect(precheck.UnmirroredImage(v, image, mirrored)).To(Equal(reason))
+		},
+		Entry("prime image", "registry.rancher.com/rancher/cluster-api-aws-controller:v2.11.0", ""),
+		Entry("staging image", "stgregistry.suse.com/rancher/cluster-api-aws-controller:v2.11.0", ""),
+		Entry("docker.io image", "docker.io/rancher/kube-rbac-proxy:v0.19.1", ""),
+		Entry("image without registry", "rancher/kube-rbac-proxy:v0.19.1", ""),
+		Entry("registry left as a clusterctl variable", "${REGISTRY:=registry.rancher.com}/rancher/cluster-api-aws-controller:v2.11.0", ""),
+		Entry("upstream registry", "registry.k8s.io/cluster-api-aws/cluster-api-aws-controller:v2.11.0", "upstream registry registry.k8s.io"),
+		Entry("registry variable with another default, set at install", "${REGISTRY:=gcr.io}/rancher/cluster-api-aws-controller:v2.11.0", ""),
+		Entry("other version", "registry.rancher.com/rancher/cluster-api-aws-controller:v2.10.0", "not in rancher-images.txt"),
+		Entry("not listed", "rancher/busybox:1.36", "not in rancher-images.txt"),
+	)
+})
@@ -0,0 +1,247 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change is a version changed between two releases, From or To is empty when added or removed
+type Change struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DigestChange is an image or artifact tag pushed again with a different content between two releases
+type DigestChange struct {
+	Repo       string `json:"repo"`
+	Tag        string `json:"tag"`
+	FromDigest string `json:"fromDigest"`
+	ToDigest   string `json:"toDigest"`
+}
+
+// Diff is what changes between two Rancher releases for Turtles
+type Diff struct {
+	From              string         `json:"from"`
+	To                string         `json:"to"`
+	Turtles           *Change        `json:"turtles,omitempty"`
+	TurtlesChart      *Change        `json:"turtlesChart,omitempty"`
+	Providers         []Change       `json:"providers"`
+	ImagesAdded       []Image        `json:"imagesAdded"`
+	ImagesRemoved     []Image        `json:"imagesRemoved"`
+	ComponentsAdded   []Image        `json:"componentsAdded"`
+	ComponentsRemoved []Image        `json:"componentsRemoved"`
+	Digests           []DigestChange `json:"digests"` // retagged images, a tag change is listed in the images added and removed
+	DigestErrors      []string       `json:"digestErrors,omitempty"`
+}
+
+// DigestFunc returns the digest of an image or component artifact of a release
+type DigestFunc func(r *Release, i Image, component bool) (string, error)
+
+/**
+ * Compare two releases
+ * @param from Base release, e.g. the current GA
+ * @param to Candidate release, e.g. the next RC
+ * @param digest Resolves the digests of the images shipped with the same tag, digests are not compared when nil
+ * @returns The changes between the releases, digest lookup failures are reported in DigestErrors
+ */
+func Compare(from, to *Release, digest DigestFunc) *Diff {
+	d := &Diff{From: from.RancherVersion, To: to.RancherVersion}
+
+	if from.TurtlesVersion != to.TurtlesVersion {
+		d.Turtles = &Change{Name: "rancher-turtles", From: from.TurtlesVersion, To: to.TurtlesVersion}
+	}
+	if from.TurtlesChartVersion != to.TurtlesChartVersion {
+		d.TurtlesChart = &Change{Name: "rancher-turtles-providers", From: from.TurtlesChartVersion, To: to.TurtlesChartVersion}
+	}
+	for _, name := range providerNames(from, to) {
+		if from.Providers[name] != to.Providers[name] {
+			d.Providers = append(d.Providers, Change{Name: name, From: from.Providers[name], To: to.Providers[name]})
+		}
+	}
+	if from.ASOVersion != to.ASOVersion {
+		d.Providers = append(d.Providers, Change{Name: "azureserviceoperator", From: from.ASOVersion, To: to.ASOVersion})
+	}
+
+	fromImages, toImages := tagged(from.Images()), tagged(to.Images())
+	fromComponents, toComponents := tagged(from.Components()), tagged(to.Components())
+	d.ImagesRemoved, d.ImagesAdded = compareSets(fromImages, toImages)
+	d.ComponentsRemoved, d.ComponentsAdded = compareSets(fromComponents, toComponents)
+
+	if digest != nil {
+		d.compareDigests(from, to, fromImages, toImages, false, digest)
+		d.compareDigests(from, to, fromComponents, toComponents, true, digest)
+	}
+	return d
+}
+
+// tagged drops the images of providers the release does not ship
+func tagged(images []Image) []Image {
+	var kept []Image
+	for _, i := range images {
+		if i.Tag != "" {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// compareSets returns the images only in a and only in b
+func compareSets(a, b []Image) (onlyA, onlyB []Image) {
+	inA, inB := map[Image]bool{}, map[Image]bool{}
+	for _, i := range a {
+		inA[i] = true
+	}
+	for _, i := range b {
+		inB[i] = true
+	}
+	for _, i := range a {
+		if !inB[i] {
+			onlyA = append(onlyA, i)
+		}
+	}
+	for _, i := range b {
+		if !inA[i] {
+			onlyB = append(onlyB, i)
+		}
+	}
+	sortImages(onlyA)
+	sortImages(onlyB)
+	return onlyA, onlyB
+}
+
+func sortImages(images []Image) {
+	sort.Slice(images, func(i, j int) bool { return images[i].String() < images[j].String() })
+}
+
+// compareDigests records the repositories shipped with the same tag by both releases, when the digest differs
+func (d *Diff) compareDigests(from, to *Release, a, b []Image, component bool, digest DigestFunc) {
+	tags := map[string]string{}
+	for _, i := range a {
+		tags[i.Repo] = i.Tag
+	}
+	for _, i := range b {
+		// A new tag is expected to have a new digest, it is already listed in the images added and removed
+		if tags[i.Repo] != i.Tag {
+			continue
+		}
+		fromDigest, err := digest(from, i, component)
+		if err != nil {
+			d.DigestErrors = append(d.DigestErrors, err.Error())
+			continue
+		}
+		toDigest, err := digest(to, i, component)
+		if err != nil {
+			d.DigestErrors = append(d.DigestErrors, err.Error())
+			continue
+		}
+		if fromDigest != toDigest {
+			d.Digests = append(d.Digests, DigestChange{Repo: i.Repo, Tag: i.Tag, FromDigest: fromDigest, ToDigest: toDigest})
+		}
+	}
+	sort.Slice(d.Digests, func(i, j int) bool { return d.Digests[i].Repo < d.Digests[j].Repo })
+}
+
+// Empty tells if nothing changes between the releases
+func (d *Diff) Empty() bool {
+	return d.Turtles == nil && d.TurtlesChart == nil && len(d.Providers) == 0 &&
+		len(d.ImagesAdded) == 0 && len(d.ImagesRemoved) == 0 &&
+		len(d.ComponentsAdded) == 0 && len(d.ComponentsRemoved) == 0 && len(d.Digests) == 0
+}
+
+// JSON returns the diff as indented JSON
+func (d *Diff) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Markdown returns the diff formatted for release notes and PR comments
+func (d *Diff) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Turtles changes from Rancher %s to %s\n\n", d.From, d.To)
+	if d.Empty() {
+		b.WriteString("No change.\n")
+	}
+
+	var versions []Change
+	for _, c := range []*Change{d.Turtles, d.TurtlesChart} {
+		if c != nil {
+			versions = append(versions, *c)
+		}
+	}
+	versions = append(versions, d.Providers...)
+	if len(versions) > 0 {
+		fmt.Fprintf(&b, "### Versions\n\n| Component | %s | %s |\n| --- | --- | --- |\n", d.From, d.To)
+		for _, c := range versions {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", c.Name, orDash(c.From), orDash(c.To))
+		}
+		b.WriteString("\n")
+	}
+
+	writeImages(&b, "Images added", d.ImagesAdded)
+	writeImages(&b, "Images removed", d.ImagesRemoved)
+	writeImages(&b, "Components added", d.ComponentsAdded)
+	writeImages(&b, "Components removed", d.ComponentsRemoved)
+
+	if len(d.Digests) > 0 {
+		fmt.Fprintf(&b, "### ⚠️ Retagged\n\nSame tag, new content.\n\n| Image | %s | %s |\n| --- | --- | --- |\n", d.From, d.To)
+		for _, c := range d.Digests {
+			fmt.Fprintf(&b, "| `%s:%s` | %s | %s |\n", c.Repo, c.Tag, shortDigest(c.FromDigest), shortDigest(c.ToDigest))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(d.DigestErrors) > 0 {
+		b.WriteString("### Digests not compared\n\n")
+		for _, e := range d.DigestErrors {
+			fmt.Fprintf(&b, "- %s\n", e)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func writeImages(b *strings.Builder, title string, images []Image) {
+	if len(images) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "### %s\n\n", title)
+	for _, i := range images {
+		fmt.Fprintf(b, "- `%s`\n", i)
+	}
+	b.WriteString("\n")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// shortDigest keeps the first 12 hex characters of a digest, as docker does
+func shortDigest(digest string) string {
+	if _, hex, found := strings.Cut(digest, ":"); found && len(hex) > 12 {
+		return hex[:12]
+	}
+	return digest
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/precheck"
+)
+
+var _ = Describe("Diff", func() {
+	var from, to *precheck.Release
+
+	BeforeEach(func() {
+		from = &precheck.Release{
+			RancherVersion:      "2.14.1",
+			TurtlesVersion:      "v0.26.0",
+			TurtlesChartVersion: "108.0.0_up0.26.0",
+			Providers:           map[string]string{"cluster-api": "v1.12.6", "aws": "v2.11.0"},
+			ASOVersion:          "v2.13.0",
+		}
+		to = &precheck.Release{
+			RancherVersion:      "2.14.2-rc1",
+			TurtlesVersion:      "v0.26.1",
+			TurtlesChartVersion: "108.0.1_up0.26.1",
+			Providers:           map[string]string{"cluster-api": "v1.12.6", "aws": "v2.11.1", "gcp": "v1.11.0"},
+			ASOVersion:          "v2.13.0",
+		}
+	})
+
+	// digests returns the digest of an image or component by release, repository and tag
+	digests := func(changed map[string]bool) precheck.DigestFunc {
+		return func(r *precheck.Release, i precheck.Image, component bool) (string, error) {
+			if r == to && changed[i.Repo] {
+				return "sha256:bbbbbbbbbbbbbbbbbbbb", nil
+			}
+			return "sha256:aaaaaaaaaaaaaaaaaaaa", nil
+		}
+	}
+
+	It("lists the version, image and component changes", func() {
+		d := precheck.Compare(from, to, nil)
+
+		Expect(d.Turtles).To(Equal(&precheck.Change{Name: "rancher-turtles", From: "v0.26.0", To: "v0.26.1"}))
+		Expect(d.TurtlesChart).To(Equal(&precheck.Change{Name: "rancher-turtles-providers", From: "108.0.0_up0.26.0", To: "108.0.1_up0.26.1"}))
+		Expect(d.Providers).To(Equal([]precheck.Change{
+			{Name: "aws", From: "v2.11.0", To: "v2.11.1"},
+			{Name: "gcp", To: "v1.11.0"},
+		}))
+		Expect(d.ImagesAdded).To(ContainElements(
+			precheck.Image{Repo: "rancher/turtles", Tag: "v0.26.1"},
+			precheck.Image{Repo: "rancher/cluster-api-gcp-controller", Tag: "v1.11.0"},
+		))
+		Expect(d.ImagesRemoved).To(ContainElement(precheck.Image{Repo: "rancher/turtles", Tag: "v0.26.0"}))
+		Expect(d.ImagesRemoved).To(Not(ContainElement(HaveField("Repo", "rancher/cluster-api-controller"))))
+		Expect(d.ComponentsAdded).To(ContainElement(precheck.Image{Repo: "rancher/cluster-api-gcp-controller-components", Tag: "v1.11.0"}))
+		Expect(d.Digests).To(BeEmpty())
+		Expect(d.Empty()).To(BeFalse())
+	})
+
+	It("only lists a digest change when the tag is the same", func() {
+		// Both a retagged image and an image with a new tag have a new digest
+		d := precheck.Compare(from, to, digests(map[string]bool{
+			"rancher/cluster-api-controller":     true,
+			"rancher/cluster-api-aws-controller": true,
+		}))
+
+		Expect(d.Digests).To(Equal([]precheck.DigestChange{{
+			Repo:       "rancher/cluster-api-controller",
+			Tag:        "v1.12.6",
+			FromDigest: "sha256:aaaaaaaaaaaaaaaaaaaa",
+			ToDigest:   "sha256:bbbbbbbbbbbbbbbbbbbb",
+		}}))
+		Expect(d.DigestErrors).To(BeEmpty())
+	})
+
+	It("reports the digests it cannot resolve", func() {
+		d := precheck.Compare(from, to, func(r *precheck.Release, i precheck.Image, component bool) (string, error) {
+			if i.Repo == "rancher/cluster-api-controller" {
+				return "", fmt.Errorf("%s not found", i)
+			}
+			return "sha256:aaaaaaaaaaaaaaaaaaaa", nil
+		})
+
+		Expect(d.Digests).To(BeEmpty())
+		Expect(d.DigestErrors).To(Equal([]string{"rancher/cluster-api-controller:v1.12.6 not found"}))
+	})
+
+	It("finds no change between the same release", func() {
+		d := precheck.Compare(from, from, digests(nil))
+
+		Expect(d.Empty()).To(BeTrue())
+		Expect(d.Markdown()).To(Equal("## Turtles changes from Rancher 2.14.1 to 2.14.1\n\nNo change.\n"))
+	})
+
+	It("formats the diff as markdown", func() {
+		md := precheck.Compare(from, to, digests(map[string]bool{"rancher/cluster-api-controller": true})).Markdown()
+
+		Expect(md).To(HavePrefix("## Turtles changes from Rancher 2.14.1 to 2.14.2-rc1\n\n"))
+		Expect(md).To(ContainSubstring("### Versions\n\n| Component | 2.14.1 | 2.14.2-rc1 |\n| --- | --- | --- |\n" +
+			"| rancher-turtles | v0.26.0 | v0.26.1 |\n" +
+			"| rancher-turtles-providers | 108.0.0_up0.26.0 | 108.0.1_up0.26.1 |\n" +
+			"| aws | v2.11.0 | v2.11.1 |\n" +
+			"| gcp | - | v1.11.0 |\n\n"))
+		Expect(md).To(ContainSubstring("### Images added\n\n"))
+		Expect(md).To(ContainSubstring("- `rancher/cluster-api-gcp-controller:v1.11.0`\n"))
+		Expect(md).To(ContainSubstring("### Images removed\n\n"))
+		Expect(md).To(ContainSubstring("### Components added\n\n"))
+		Expect(md).To(ContainSubstring("| `rancher/cluster-api-controller:v1.12.6` | aaaaaaaaaaaa | bbbbbbbbbbbb |\n"))
+		Expect(md).To(Not(ContainSubstring("Digests not compared")))
+	})
+})
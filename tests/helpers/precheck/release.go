@@ -0,0 +1,212 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package precheck resolves the Turtles, provider and image versions shipped with a Rancher
+// release, as used by the airgap precheck, and compares two releases.
+package precheck
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// asoRepo is the Azure Service Operator image, its version is read from the providers chart values.yaml
+const asoRepo = "rancher/azureserviceoperator"
+
+// Fetcher downloads a file by URL
+type Fetcher func(url string) ([]byte, error)
+
+// Release holds the versions shipped with a Rancher release
+type Release struct {
+	RancherVersion      string            `json:"rancherVersion"`
+	Community           bool              `json:"community"`           // community channel, only the Turtles and core CAPI images are shipped
+	TurtlesChartVersion string            `json:"turtlesChartVersion"` // OCI compatible, e.g. 108.0.0_up0.26.0
+	TurtlesVersion      string            `json:"turtlesVersion"`      // e.g. v0.26.0
+	Providers           map[string]string `json:"providers"`           // provider version by config-prime.yaml name
+	ASOVersion          string            `json:"asoVersion,omitempty"`
+}
+
+// Image is an image or artifact of a release, without registry
+type Image struct {
+	Repo string `json:"repo"`
+	Tag  string `json:"tag"`
+}
+
+// String returns the image reference without registry
+func (i Image) String() string {
+	return i.Repo + ":" + i.Tag
+}
+
+/**
+ * Resolve the versions shipped with a Rancher release from its build.yaml and the Turtles clusterctl config
+ * @param fetch Fetcher used to download the files
+ * @param rancherVersion Released Rancher version, e.g. 2.14.1 or 2.14.2-rc1
+ * @param community Read config.yaml of community channels instead of config-prime.yaml
+ * @returns The resolved release
+ */
+func Resolve(fetch Fetcher, rancherVersion string, community bool) (*Release, error) {
+	r := &Release{RancherVersion: rancherVersion, Community: community, Providers: map[string]string{}}
+
+	// 1. Turtles version from Rancher build.yaml
+	data, err := fetch(fmt.Sprintf("https://raw.githubusercontent.com/rancher/rancher/v%s/build.yaml", rancherVersion))
+	if err != nil {
+		return nil, err
+	}
+	var build struct {
+		TurtlesVersion string `yaml:"turtlesVersion"`
+	}
+	if err := yaml.Unmarshal(data, &build); err != nil {
+		return nil, fmt.Errorf("parsing build.yaml of Rancher %s: %w", rancherVersion, err)
+	}
+	_, turtles, found := strings.Cut(build.TurtlesVersion, "+up")
+	if !found {
+		return nil, fmt.Errorf("unexpected turtlesVersion %q in build.yaml of Rancher %s", build.TurtlesVersion, rancherVersion)
+	}
+	// Convert to OCI-compatible format (replace '+' with '_')
+	r.TurtlesChartVersion = strings.ReplaceAll(build.TurtlesVersion, "+", "_")
+	r.TurtlesVersion = "v" + strings.TrimPrefix(turtles, "v")
+
+	// 2. Provider versions from Turtles config-prime.yaml, or config.yaml for community channels
+	if err := r.resolveProviders(fetch); err != nil {
+		return nil, err
+	}
+
+	// 3. ASO is not listed in config-prime.yaml, read it from the providers chart values.yaml
+	if !community {
+		data, err := fetch(r.ProvidersChartURL("values.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		var values struct {
+			Images struct {
+				InfrastructureAzure struct {
+					AzureServiceOperator struct {
+						Tag string `yaml:"tag"`
+					} `yaml:"azureServiceOperator"`
+				} `yaml:"infrastructureAzure"`
+			} `yaml:"images"`
+		}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("parsing providers chart values.yaml of Turtles %s: %w", r.TurtlesVersion, err)
+		}
+		r.ASOVersion = values.Images.InfrastructureAzure.AzureServiceOperator.Tag
+	}
+	return r, nil
+}
+
+func (r *Release) resolveProviders(fetch Fetcher) error {
+	configFile := "config-prime.yaml"
+	if r.Community {
+		configFile = "config.yaml"
+	}
+	data, err := fetch(fmt.Sprintf("https://raw.githubusercontent.com/rancher/turtles/refs/tags/%s/internal/controllers/clusterctl/%s", r.TurtlesVersion, configFile))
+	if err != nil {
+		return err
+	}
+	var configMap struct {
+		Data struct {
+			Clusterctl string `yaml:"clusterctl.yaml"`
+		} `yaml:"data"`
+	}
+	if err := yaml.Unmarshal(data, &configMap); err != nil {
+		return fmt.Errorf("parsing %s of Turtles %s: %w", configFile, r.TurtlesVersion, err)
+	}
+	var clusterctl struct {
+		Providers []struct {
+			Name string `yaml:"name"`
+			URL  string `yaml:"url"`
+		} `yaml:"providers"`
+	}
+	if err := yaml.Unmarshal([]byte(configMap.Data.Clusterctl), &clusterctl); err != nil {
+		return fmt.Errorf("parsing clusterctl.yaml of Turtles %s: %w", r.TurtlesVersion, err)
+	}
+
+	re := regexp.MustCompile(`\/releases\/([^/]+)`)
+	for _, p := range clusterctl.Providers {
+		if matches := re.FindStringSubmatch(p.URL); len(matches) == 2 {
+			r.Providers[p.Name] = matches[1]
+		}
+	}
+	if len(r.Providers) == 0 {
+		return fmt.Errorf("no provider release found in %s of Turtles %s", configFile, r.TurtlesVersion)
+	}
+	return nil
+}
+
+// ProvidersChartURL returns the URL of a file of the providers chart shipped with the release
+func (r *Release) ProvidersChartURL(file string) string {
+	return fmt.Sprintf("https://raw.githubusercontent.com/rancher/turtles/refs/tags/%s/charts/rancher-turtles-providers/%s", r.TurtlesVersion, file)
+}
+
+// Images returns the Turtles and provider images of the release
+func (r *Release) Images() []Image {
+	if r.Community {
+		// Community channels only ship the Turtles and core CAPI images, the other providers are pulled from upstream
+		return []Image{
+			{"rancher/turtles", r.TurtlesVersion},
+			{"rancher/cluster-api-controller", r.Providers["cluster-api"]},
+		}
+	}
+	return []Image{
+		{"rancher/turtles", r.TurtlesVersion},
+		{"rancher/charts/rancher-turtles-providers", r.TurtlesChartVersion}, // This is actually chart repo
+		{"rancher/cluster-api-controller", r.Providers["cluster-api"]},
+		{"rancher/cluster-api-addon-provider-fleet", r.Providers["rancher-fleet"]},
+		{"rancher/cluster-api-aws-controller", r.Providers["aws"]},
+		{"rancher/cluster-api-azure-controller", r.Providers["azure"]},
+		{"rancher/cluster-api-gcp-controller", r.Providers["gcp"]},
+		{"rancher/cluster-api-vsphere-controller", r.Providers["vsphere"]},
+		{"rancher/cluster-api-provider-rke2-bootstrap", r.Providers["rke2"]},
+		{"rancher/cluster-api-provider-rke2-controlplane", r.Providers["rke2"]},
+		{"rancher/kubeadm-bootstrap-controller", r.Providers["kubeadm"]},
+		{"rancher/kubeadm-control-plane-controller", r.Providers["kubeadm"]},
+		{asoRepo, r.ASOVersion},
+	}
+}
+
+// Components returns the component manifest artifacts of the release, only published for Prime
+func (r *Release) Components() []Image {
+	if r.Community {
+		return nil
+	}
+	return []Image{
+		{"rancher/cluster-api-controller-components", r.Providers["cluster-api"]}, // This also contains capd and kubeadm manifests
+		{"rancher/cluster-api-addon-provider-fleet-components", r.Providers["rancher-fleet"]},
+		{"rancher/cluster-api-aws-controller-components", r.Providers["aws"]},
+		{"rancher/cluster-api-azure-controller-components", r.Providers["azure"]},
+		{"rancher/cluster-api-gcp-controller-components", r.Providers["gcp"]},
+		{"rancher/cluster-api-provider-rke2-components", r.Providers["rke2"]},
+		{"rancher/cluster-api-vsphere-controller-components", r.Providers["vsphere"]},
+	}
+}
+
+// providerNames returns the sorted provider names of the releases
+func providerNames(releases ...*Release) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, r := range releases {
+		for name := range r.Providers {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,410 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/components"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/matrix"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/mirror"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/registryauth"
+	"gopkg.in/yaml.v3"
+)
+
+// Registries are the registries the artifacts of the releases are published to
+type Registries struct {
+	Prime     string // e.g. registry.rancher.com
+	StgPrime  string // prime rc and alpha builds
+	Community string // e.g. docker.io
+}
+
+// ImageRegistry returns the registry the images of a release are published to, prime rc/alpha builds go to staging
+func (r Registries) ImageRegistry(release *Release) string {
+	switch {
+	case release.Community:
+		return r.Community
+	case strings.Contains(release.RancherVersion, "-rc") || strings.Contains(release.RancherVersion, "-alpha"):
+		return r.StgPrime
+	}
+	return r.Prime
+}
+
+// Validation builds the airgap precheck checks of a resolved release
+type Validation struct {
+	Release      *Release
+	Registries   Registries
+	ArtifactsURL string // Prime artifacts, holding rancher-images.txt
+	Fetch        Fetcher
+	Auth         *registryauth.Registries
+	Matrix       *matrix.Matrix // the Kubernetes versions are not checked when nil
+}
+
+// RancherImagesURL returns the URL of the rancher-images.txt of the release
+func (v *Validation) RancherImagesURL() string {
+	if v.Release.Community {
+		return fmt.Sprintf("https://github.com/rancher/rancher/releases/download/v%s/rancher-images.txt", v.Release.RancherVersion)
+	}
+	return fmt.Sprintf("%s/rancher/v%s/rancher-images.txt", v.ArtifactsURL, v.Release.RancherVersion)
+}
+
+/**
+ * Build all the checks of the release
+ * Community channels only ship the Turtles and core CAPI images, so only their registry,
+ * rancher-images.txt and package-env checks apply.
+ * @returns The checks, an error if the providers chart cannot be read
+ */
+func (v *Validation) Checks() ([]Check, error) {
+	images := v.Release.Images()
+	rancherImages := v.imageListLoader(v.RancherImagesURL())
+	packageEnv := Check{Artifact: "scripts/package-env", Name: "CAPI version", Run: v.checkPackageEnvCAPIVersion}
+
+	if v.Release.Community {
+		checks := v.registryChecks(v.Registries.Community, images)
+		checks = append(checks, imageListChecks(rancherImages, images)...)
+		return append(checks, packageEnv), nil
+	}
+
+	checks, err := v.chartValuesChecks()
+	if err != nil {
+		return nil, err
+	}
+	checks = append(checks, v.registryChecks(v.Registries.ImageRegistry(v.Release), images)...)
+	// Components are always stored on prime registry, even for rc/alpha releases
+	checks = append(checks, v.registryChecks(v.Registries.Prime, v.Release.Components())...)
+	checks = append(checks, v.componentManifestChecks(v.Registries.Prime, rancherImages)...)
+	checks = append(checks, imageListChecks(rancherImages, images)...)
+	if v.Matrix != nil {
+		checks = append(checks, v.compatibilityMatrixCheck())
+	}
+	return append(checks, packageEnv), nil
+}
+
+/**
+ * Check an artifact exists in an OCI registry
+ * @param host Registry host
+ * @param repo Repository without registry, e.g. rancher/turtles
+ * @param tag Tag of the artifact
+ * @returns nil if found, otherwise an error telling a missing artifact from a credential problem
+ */
+func (v *Validation) CheckOCI(host, repo, tag string) error {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return fmt.Errorf("version for %s/%s is empty - cannot check OCI registry", host, repo)
+	}
+	ref := fmt.Sprintf("%s/%s:%s", host, repo, tag)
+	_, err := crane.Head(ref, v.Auth.CraneOptions(host)...)
+	err = registryauth.Classify(err)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, registryauth.ErrUnauthorized) && !v.Auth.HasCredentials(host):
+		return fmt.Errorf("unauthorized to read %s anonymously, it is private or missing, set credentials for %s: %w", ref, host, err)
+	case errors.Is(err, registryauth.ErrUnauthorized):
+		return fmt.Errorf("credentials for %s rejected reading %s: %w", host, ref, err)
+	case errors.Is(err, registryauth.ErrNotFound):
+		return fmt.Errorf("artifact not found: %s", ref)
+	}
+	return fmt.Errorf("unable to check %s: %w", ref, err)
+}
+
+// checkPackageEnvCAPIVersion checks the CAPI controller tag Rancher is built with matches the Turtles clusterctl config
+func (v *Validation) checkPackageEnvCAPIVersion() error {
+	url := fmt.Sprintf("https://raw.githubusercontent.com/rancher/rancher/refs/tags/v%s/scripts/package-env", v.Release.RancherVersion)
+	data, err := v.Fetch(url)
+	if err != nil {
+		return err
+	}
+	re := regexp.MustCompile(`CLUSTER_API_CONTROLLER_TAG=(v[0-9]+\.[0-9]+\.[0-9]+)`)
+	matches := re.FindStringSubmatch(string(data))
+	if len(matches) != 2 {
+		return errors.New("CLUSTER_API_CONTROLLER_TAG not found in package-env")
+	}
+	if expected := v.Release.Providers["cluster-api"]; matches[1] != expected {
+		return fmt.Errorf("package-env has %s, the clusterctl config %s", matches[1], expected)
+	}
+	return nil
+}
+
+// imageListLoader returns a function reading an image list such as rancher-images.txt once, whatever the number of checks using it
+func (v *Validation) imageListLoader(url string) func() (map[string]bool, error) {
+	return sync.OnceValues(func() (map[string]bool, error) {
+		data, err := v.Fetch(url)
+		if err != nil {
+			return nil, err
+		}
+		images := map[string]bool{}
+		for _, ref := range mirror.ParseList(data) {
+			images[ref] = true
+		}
+		return images, nil
+	})
+}
+
+// registryChecks checks the images exist in a registry
+func (v *Validation) registryChecks(host string, images []Image) []Check {
+	var checks []Check
+	for _, i := range images {
+		checks = append(checks, Check{
+			Artifact: i.String(),
+			Name:     "published in " + host,
+			Run:      func() error { return v.CheckOCI(host, i.Repo, i.Tag) },
+		})
+	}
+	return checks
+}
+
+// imageListChecks checks the images are listed in an image list such as rancher-images.txt
+func imageListChecks(load func() (map[string]bool, error), images []Image) []Check {
+	var checks []Check
+	for _, i := range images {
+		checks = append(checks, Check{
+			Artifact: i.String(),
+			Name:     "listed in rancher-images.txt",
+			Run: func() error {
+				listed, err := load()
+				if err != nil {
+					return err
+				}
+				if !listed[i.String()] {
+					return errors.New("missing in rancher-images.txt")
+				}
+				return nil
+			},
+		})
+	}
+	return checks
+}
+
+// chartImage is an image found in the providers chart values.yaml
+type chartImage struct {
+	path string // path of the image in values.yaml, e.g. images.infrastructureAWS
+	repo string // repository without registry, e.g. rancher/cluster-api-aws-controller
+	tag  string
+}
+
+/**
+ * Collect all the images of the providers chart values, i.e. every map holding a tag
+ * @param path Path of the node in values.yaml
+ * @param node Node of values.yaml to walk
+ * @returns List of images sorted by path
+ */
+func collectChartImages(path string, node interface{}) []chartImage {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var images []chartImage
+	if tag, found := m["tag"]; found {
+		repo, _ := m["repository"].(string)
+		if repo == "" {
+			repo, _ = m["image"].(string)
+		}
+		// Drop the registry, values may hold e.g. registry.rancher.com/rancher/turtles
+		if i := strings.Index(repo, "rancher/"); i > 0 {
+			repo = repo[i:]
+		}
+		images = append(images, chartImage{path: path, repo: repo, tag: fmt.Sprint(tag)})
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		images = append(images, collectChartImages(strings.TrimPrefix(path+"."+k, "."), m[k])...)
+	}
+	return images
+}
+
+// sameVersion compares versions ignoring the leading v, which values.yaml and config-prime.yaml do not always agree on
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// chartValuesChecks checks the providers chart versions match config-prime.yaml
+func (v *Validation) chartValuesChecks() ([]Check, error) {
+	data, err := v.Fetch(v.Release.ProvidersChartURL("values.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parsing providers chart values.yaml of Turtles %s: %w", v.Release.TurtlesVersion, err)
+	}
+	chartImages := collectChartImages("", values)
+	if len(chartImages) == 0 {
+		return nil, fmt.Errorf("no image found in the providers chart values.yaml of Turtles %s", v.Release.TurtlesVersion)
+	}
+
+	data, err = v.Fetch(v.Release.ProvidersChartURL("Chart.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var chart struct {
+		AppVersion string `yaml:"appVersion"`
+	}
+	if err := yaml.Unmarshal(data, &chart); err != nil {
+		return nil, fmt.Errorf("parsing providers chart Chart.yaml of Turtles %s: %w", v.Release.TurtlesVersion, err)
+	}
+
+	expected := map[string]string{}
+	for _, i := range v.Release.Images() {
+		expected[i.Repo] = i.Tag
+	}
+
+	var checks []Check
+	// appVersion is the Turtles version, unless left as a placeholder for the release pipeline
+	if chart.AppVersion != "" && !sameVersion(chart.AppVersion, "0.0.0") {
+		checks = append(checks, Check{
+			Artifact: "rancher/turtles:" + chart.AppVersion,
+			Name:     "Chart.yaml appVersion",
+			Run: func() error {
+				if !sameVersion(chart.AppVersion, v.Release.TurtlesVersion) {
+					return fmt.Errorf("config-prime.yaml has %s", v.Release.TurtlesVersion)
+				}
+				return nil
+			},
+		})
+	}
+	for _, i := range chartImages {
+		checks = append(checks, Check{
+			Artifact: i.repo + ":" + i.tag,
+			Name:     "values.yaml " + i.path,
+			Run: func() error {
+				version, found := expected[i.repo]
+				switch {
+				case i.repo == asoRepo:
+					// Its version is the one of values.yaml, it is not released through config-prime.yaml
+					return fmt.Errorf("%w: not in config-prime.yaml", ErrSkipped)
+				case !found:
+					return errors.New("not in config-prime.yaml")
+				case !sameVersion(i.tag, version):
+					return fmt.Errorf("config-prime.yaml has %s", version)
+				}
+				return nil
+			},
+		})
+	}
+	return checks, nil
+}
+
+/**
+ * Check an image referenced by a component manifest is available in an airgapped install
+ * @param image Image reference from the manifest
+ * @param mirrored Images shipped with Rancher, i.e. rancher-images.txt and the provider images
+ * @returns Reason why the image is not available, empty if it is
+ */
+func (v *Validation) unmirroredImage(image string, mirrored map[string]bool) string {
+	// Registry may be left as a clusterctl variable, e.g. ${REGISTRY:=registry.rancher.com}/rancher/...
+	if strings.HasPrefix(image, "${") {
+		if i := strings.Index(image, "}/"); i > 0 {
+			image = image[i+2:]
+		}
+	}
+
+	registry := strings.TrimSuffix(image, "/"+components.StripRegistry(image))
+	if registry != image && registry != v.Registries.Prime && registry != v.Registries.StgPrime && registry != "docker.io" {
+		return "upstream registry " + registry
+	}
+	if !mirrored[strings.TrimPrefix(components.StripRegistry(image), "docker.io/")] {
+		return "not in rancher-images.txt"
+	}
+	return ""
+}
+
+// componentManifestChecks checks the component manifests are complete and reference mirrored images
+func (v *Validation) componentManifestChecks(host string, loadRancherImages func() (map[string]bool, error)) []Check {
+	var checks []Check
+	for _, c := range v.Release.Components() {
+		checks = append(checks, Check{
+			Artifact: c.String(),
+			Name:     "component manifests",
+			Run: func() error {
+				listed, err := loadRancherImages()
+				if err != nil {
+					return err
+				}
+				mirrored := map[string]bool{}
+				for image := range listed {
+					mirrored[image] = true
+				}
+				for _, i := range v.Release.Images() {
+					mirrored[i.String()] = true
+				}
+
+				ref := fmt.Sprintf("%s/%s", host, c)
+				r, err := name.ParseReference(ref, v.Auth.NameOptions(host)...)
+				if err != nil {
+					return err
+				}
+				files, err := components.PullReference(r, v.Auth.RemoteOptions(host)...)
+				if err != nil {
+					return fmt.Errorf("unable to pull %s: %w", ref, registryauth.Classify(err))
+				}
+
+				var errs []error
+				var manifests int
+				for _, f := range files {
+					if !components.IsManifest(f) {
+						continue
+					}
+					manifests++
+
+					objects, err := components.Parse(f)
+					if err != nil {
+						errs = append(errs, err)
+					}
+					for _, o := range objects {
+						for _, image := range o.Images {
+							if reason := v.unmirroredImage(image, mirrored); reason != "" {
+								errs = append(errs, fmt.Errorf("%s: %s %s", o, image, reason))
+							}
+						}
+					}
+				}
+				if manifests == 0 {
+					errs = append(errs, errors.New("no component manifest in the artifact"))
+				}
+				return errors.Join(errs...)
+			},
+		})
+	}
+	return checks
+}
+
+// compatibilityMatrixCheck checks the Kubernetes versions of the matrix are supported by the providers
+func (v *Validation) compatibilityMatrixCheck() Check {
+	release, versions, err := v.Matrix.Release(v.Release.RancherVersion)
+	return Check{
+		Artifact: "compatibility-matrix.yaml " + release,
+		Name:     "Kubernetes versions supported",
+		Run: func() error {
+			if err != nil {
+				return err
+			}
+			return errors.Join(v.Matrix.CheckKubernetes(versions, v.Release.Providers)...)
+		},
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck_test
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/precheck"
+)
+
+// providersValues is a providers chart values.yaml, with an image missing from config-prime.yaml and one with another version
+const providersValues = `
+images:
+  core:
+    repository: registry.rancher.com/rancher/cluster-api-controller
+    tag: v1.12.7
+  infrastructureAWS:
+    repository: rancher/cluster-api-aws-controller
+    tag: v2.11.0
+  infrastructureAzure:
+    azureServiceOperator:
+      repository: rancher/azureserviceoperator
+      tag: v2.13.0
+  infrastructureDocker:
+    repository: rancher/cluster-api-docker-controller
+    tag: v1.12.7
+`
+
+var _ = Describe("Validation", func() {
+	release := &precheck.Release{
+		RancherVersion:      "2.14.1",
+		TurtlesVersion:      "v0.26.1",
+		TurtlesChartVersion: "108.0.1_up0.26.1",
+		Providers: map[string]string{
+			"cluster-api": "v1.12.7",
+			"aws":         "v2.11.1",
+		},
+		ASOVersion: "v2.13.0",
+	}
+
+	fetch := func(url string) ([]byte, error) {
+		switch {
+		case strings.HasSuffix(url, "/values.yaml"):
+			return []byte(providersValues), nil
+		case strings.HasSuffix(url, "/Chart.yaml"):
+			return []byte("appVersion: v0.26.1\n"), nil
+		}
+		return nil, fmt.Errorf("unexpected fetch of %s", url)
+	}
+
+	It("reports the values.yaml images not in config-prime.yaml, except ASO", func() {
+		v := &precheck.Validation{Release: release, Fetch: fetch}
+		checks, err := v.Checks()
+		Expect(err).To(Not(HaveOccurred()))
+
+		var chartChecks []precheck.Check
+		for _, c := range checks {
+			if strings.HasPrefix(c.Name, "values.yaml ") || c.Name == "Chart.yaml appVersion" {
+				chartChecks = append(chartChecks, c)
+			}
+		}
+		results := precheck.RunChecks(chartChecks, 1)
+
+		status := map[string]precheck.Status{}
+		detail := map[string]string{}
+		for _, r := range results {
+			status[r.Artifact] = r.Status
+			detail[r.Artifact] = r.Detail
+		}
+		Expect(status).To(Equal(map[string]precheck.Status{
+			"rancher/turtles:v0.26.1":                       precheck.Passed,
+			"rancher/cluster-api-controller:v1.12.7":        precheck.Passed,
+			"rancher/cluster-api-aws-controller:v2.11.0":    precheck.Failed,
+			"rancher/azureserviceoperator:v2.13.0":          precheck.Skipped,
+			"rancher/cluster-api-docker-controller:v1.12.7": precheck.Failed,
+		}))
+		Expect(detail["rancher/cluster-api-aws-controller:v2.11.0"]).To(ContainSubstring("config-prime.yaml has v2.11.1"))
+		Expect(detail["rancher/cluster-api-docker-controller:v1.12.7"]).To(ContainSubstring("not in config-prime.yaml"))
+		Expect(precheck.Failures(results)).To(HaveLen(2))
+	})
+})
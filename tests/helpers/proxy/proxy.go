@@ -0,0 +1,266 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package proxy is a forward HTTP(S) proxy standing for the enterprise proxy of the proxy install
+// tests: it tunnels CONNECT requests, forwards plain HTTP ones and records every host it reaches,
+// which documents the egress Rancher, Turtles and the providers need.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const dialTimeout = 30 * time.Second
+
+// hopHeaders are the headers of a single connection, not forwarded
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Host is a destination reached through the proxy
+type Host struct {
+	Address  string // host:port
+	Requests int
+	Failures int // connections or requests that failed
+}
+
+// Server is a forward proxy, create it with New
+type Server struct {
+	addr      string
+	listener  net.Listener
+	srv       *http.Server
+	transport *http.Transport
+
+	mu    sync.Mutex
+	hosts map[string]*Host
+}
+
+// New creates a proxy listening on addr (e.g. ":3128")
+func New(addr string) *Server {
+	return &Server{
+		addr: addr,
+		transport: &http.Transport{
+			Proxy:                 nil, // never chain to the proxy of the environment
+			DialContext:           (&net.Dialer{Timeout: dialTimeout}).DialContext,
+			TLSHandshakeTimeout:   dialTimeout,
+			ResponseHeaderTimeout: 5 * time.Minute,
+			MaxIdleConnsPerHost:   10,
+		},
+		hosts: map[string]*Host{},
+	}
+}
+
+// Start starts serving in the background
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.addr, err)
+	}
+	s.listener = l
+	// Not a ServeMux, it would redirect the CONNECT requests
+	s.srv = &http.Server{Handler: s, ReadHeaderTimeout: 30 * time.Second}
+
+	go func() {
+		if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("proxy stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops the proxy, established tunnels are closed by their peers
+func (s *Server) Stop() error {
+	if s.srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.transport.CloseIdleConnections()
+	return s.srv.Shutdown(ctx)
+}
+
+// Port returns the port the proxy listens on
+func (s *Server) Port() string {
+	if s.listener == nil {
+		_, port, _ := net.SplitHostPort(s.addr)
+		return port
+	}
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+// URL returns the proxy URL for clients reaching it through ip, e.g. the address of the host in the pods
+func (s *Server) URL(ip string) string {
+	return "http://" + net.JoinHostPort(ip, s.Port())
+}
+
+// Hosts returns the destinations reached so far, sorted by address
+func (s *Server) Hosts() []Host {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hosts := make([]Host, 0, len(s.hosts))
+	for _, h := range s.hosts {
+		hosts = append(hosts, *h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Address < hosts[j].Address })
+	return hosts
+}
+
+// WriteReport writes the destinations reached as a table
+func (s *Server) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tREQUESTS\tFAILURES")
+	for _, h := range s.Hosts() {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", h.Address, h.Requests, h.Failures)
+	}
+	return tw.Flush()
+}
+
+func (s *Server) record(address string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, found := s.hosts[address]
+	if !found {
+		h = &Host{Address: address}
+		s.hosts[address] = h
+	}
+	h.Requests++
+	if err != nil {
+		h.Failures++
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Listening on every address, the proxy must not be open to the internet
+	if !privateClient(r.RemoteAddr) {
+		http.Error(w, "clients outside the host and the private networks are not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		s.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "this is a forward proxy, absolute URLs only", http.StatusBadRequest)
+		return
+	}
+	s.forward(w, r)
+}
+
+// privateClient tells if a client address is a loopback, private or link-local one
+func privateClient(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast())
+}
+
+// tunnel connects the client to the CONNECT destination, e.g. for HTTPS
+func (s *Server) tunnel(w http.ResponseWriter, r *http.Request) {
+	target, err := net.DialTimeout("tcp", r.Host, dialTimeout)
+	s.record(r.Host, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		target.Close()
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		target.Close()
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		client.Close()
+		target.Close()
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Through buf, it may hold bytes the client sent after the CONNECT request
+		_, _ = io.Copy(target, buf)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, target)
+		done <- struct{}{}
+	}()
+	<-done
+	client.Close()
+	target.Close()
+}
+
+// forward sends a plain HTTP request to its destination
+func (s *Server) forward(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Host
+	if r.URL.Port() == "" {
+		address = net.JoinHostPort(r.URL.Hostname(), "80")
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	resp, err := s.transport.RoundTrip(out)
+	s.record(address, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// OutboundIP returns the address of the interface of the default route, reachable from the pods of the host
+func OutboundIP() (string, error) {
+	// UDP does not send anything, the kernel only selects the route
+	conn, err := net.Dial("udp", "192.0.2.1:53")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
@@ -0,0 +1,200 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package qase reports the results of the Ginkgo suite to Qase TestOps, in the same run as
+// the Cypress tests: specs are mapped to test cases through "qase:<id>" labels, or by title.
+package qase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the Qase API v1 endpoint
+const DefaultAPIURL = "https://api.qase.io/v1"
+
+// Result statuses
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// Step is the result of a step of a test case
+type Step struct {
+	Position int    `json:"position"`
+	Status   string `json:"status"`
+	Action   string `json:"action,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Case identifies a test case by title, Qase creates it when it does not exist yet
+type Case struct {
+	Title      string `json:"title"`
+	SuiteTitle string `json:"suite_title,omitempty"` // tab separated suite path
+}
+
+// Result is the result of a test case in a run, identified by ID or by title
+type Result struct {
+	CaseID      int64    `json:"case_id,omitempty"`
+	Case        *Case    `json:"case,omitempty"`
+	Status      string   `json:"status"`
+	TimeMs      int64    `json:"time_ms"`
+	Comment     string   `json:"comment,omitempty"`
+	Stacktrace  string   `json:"stacktrace,omitempty"`
+	Attachments []string `json:"attachments,omitempty"`
+	Steps       []Step   `json:"steps,omitempty"`
+}
+
+// Client calls the Qase API of a project
+type Client struct {
+	URL     string
+	Token   string
+	Project string
+	HTTP    *http.Client
+}
+
+// NewClient creates a client of the project, url defaults to DefaultAPIURL
+func NewClient(url, token, project string) *Client {
+	if url == "" {
+		url = DefaultAPIURL
+	}
+	return &Client{
+		URL:     strings.TrimSuffix(url, "/"),
+		Token:   token,
+		Project: project,
+		HTTP:    &http.Client{Timeout: time.Minute},
+	}
+}
+
+// response is the envelope of every answer of the API
+type response struct {
+	Status       bool            `json:"status"`
+	Result       json.RawMessage `json:"result"`
+	ErrorMessage string          `json:"errorMessage"`
+}
+
+/**
+ * Call the API and decode the result of the answer
+ * @param method HTTP method
+ * @param path Path under the API URL, e.g. /run/RT
+ * @param contentType Content type of the body, empty without body
+ * @param body Request body, may be nil
+ * @param out Where to decode the result, may be nil
+ * @returns Error on transport failure, non-2xx status or false status
+ */
+func (c *Client) do(method, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequest(method, c.URL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Token", c.Token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	var r response
+	if resp.StatusCode/100 != 2 || json.Unmarshal(data, &r) != nil || !r.Status {
+		msg := r.ErrorMessage
+		if msg == "" {
+			msg = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("%s %s: HTTP %d: %s", method, path, resp.StatusCode, msg)
+	}
+	if out != nil && len(r.Result) > 0 {
+		return json.Unmarshal(r.Result, out)
+	}
+	return nil
+}
+
+func (c *Client) doJSON(method, path string, in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.do(method, path, "application/json", bytes.NewReader(data), out)
+}
+
+// CreateRun creates a run and returns its ID
+func (c *Client) CreateRun(title, description string) (int64, error) {
+	var run struct {
+		ID int64 `json:"id"`
+	}
+	err := c.doJSON(http.MethodPost, "/run/"+c.Project, map[string]string{
+		"title":       title,
+		"description": description,
+	}, &run)
+	return run.ID, err
+}
+
+// GetRun checks the run exists
+func (c *Client) GetRun(id int64) error {
+	return c.do(http.MethodGet, fmt.Sprintf("/run/%s/%d", c.Project, id), "", nil, nil)
+}
+
+// CompleteRun marks the run as completed
+func (c *Client) CompleteRun(id int64) error {
+	return c.do(http.MethodPost, fmt.Sprintf("/run/%s/%d/complete", c.Project, id), "", nil, nil)
+}
+
+// UploadAttachment uploads a file and returns its hash, to reference it in results
+func (c *Client) UploadAttachment(name string, data []byte) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	var attachments []struct {
+		Hash string `json:"hash"`
+	}
+	if err := c.do(http.MethodPost, "/attachment/"+c.Project, w.FormDataContentType(), &body, &attachments); err != nil {
+		return "", err
+	}
+	if len(attachments) == 0 {
+		return "", fmt.Errorf("no attachment returned for %s", name)
+	}
+	return attachments[0].Hash, nil
+}
+
+// CreateResults adds results to the run in one call
+func (c *Client) CreateResults(runID int64, results []Result) error {
+	return c.doJSON(http.MethodPost, fmt.Sprintf("/result/%s/%d/bulk", c.Project, runID), map[string][]Result{
+		"results": results,
+	}, nil)
+}
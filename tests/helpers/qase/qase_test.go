@@ -0,0 +1,285 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package qase_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/ginkgo/v2/types"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/qase"
+)
+
+// fakeQase is a Qase API server recording the runs, attachments and results it receives
+type fakeQase struct {
+	sync.Mutex
+	server      *httptest.Server
+	tokens      []string
+	runs        map[int64]string // ID to title
+	completed   []int64
+	attachments map[string]string // hash to content
+	results     map[int64][]qase.Result
+}
+
+func newFakeQase() *fakeQase {
+	f := &fakeQase{
+		runs:        map[int64]string{7: "existing run"},
+		attachments: map[string]string{},
+		results:     map[int64][]qase.Result{},
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeQase) reply(w http.ResponseWriter, result any) {
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": true, "result": result})
+}
+
+func (f *fakeQase) serve(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	f.Lock()
+	defer f.Unlock()
+	f.tokens = append(f.tokens, r.Header.Get("Token"))
+
+	var id int64
+	switch path := r.URL.Path; {
+	case r.Method == http.MethodPost && path == "/v1/run/RT":
+		var run struct{ Title string }
+		_ = json.NewDecoder(r.Body).Decode(&run)
+		id = int64(100 + len(f.runs))
+		f.runs[id] = run.Title
+		f.reply(w, map[string]int64{"id": id})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/v1/run/RT/"):
+		_, _ = fmt.Sscanf(path, "/v1/run/RT/%d", &id)
+		if _, found := f.runs[id]; !found {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"status":false,"errorMessage":"Run not found"}`))
+			return
+		}
+		f.reply(w, map[string]int64{"id": id})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/complete"):
+		_, _ = fmt.Sscanf(path, "/v1/run/RT/%d/complete", &id)
+		f.completed = append(f.completed, id)
+		f.reply(w, nil)
+	case r.Method == http.MethodPost && path == "/v1/attachment/RT":
+		file, header, err := r.FormFile("file")
+		Expect(err).To(Not(HaveOccurred()))
+		data, _ := io.ReadAll(file)
+		hash := fmt.Sprintf("hash-%d", len(f.attachments)+1)
+		f.attachments[hash] = header.Filename + ":" + string(data)
+		f.reply(w, []map[string]string{{"hash": hash, "filename": header.Filename}})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/bulk"):
+		_, _ = fmt.Sscanf(path, "/v1/result/RT/%d/bulk", &id)
+		var bulk struct{ Results []qase.Result }
+		Expect(json.NewDecoder(r.Body).Decode(&bulk)).To(Succeed())
+		f.results[id] = append(f.results[id], bulk.Results...)
+		f.reply(w, nil)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// byStep returns the events of a By step, order being the position of the events in the timeline
+func byStep(text string, start, end int) []types.SpecEvent {
+	events := []types.SpecEvent{{
+		SpecEventType:    types.SpecEventByStart,
+		Message:          text,
+		TimelineLocation: types.TimelineLocation{Order: start},
+	}}
+	if end > 0 {
+		events = append(events, types.SpecEvent{
+			SpecEventType:    types.SpecEventByEnd,
+			Message:          text,
+			Duration:         time.Second,
+			TimelineLocation: types.TimelineLocation{Order: end},
+		})
+	}
+	return events
+}
+
+func spec(text string, state types.SpecState, labels []string, events ...[]types.SpecEvent) types.SpecReport {
+	s := types.SpecReport{
+		ContainerHierarchyTexts:  []string{"E2E - Install"},
+		ContainerHierarchyLabels: [][]string{{"install"}},
+		LeafNodeType:             types.NodeTypeIt,
+		LeafNodeText:             text,
+		LeafNodeLabels:           labels,
+		State:                    state,
+		RunTime:                  90 * time.Second,
+	}
+	for _, e := range events {
+		s.SpecEvents = append(s.SpecEvents, e...)
+	}
+	return s
+}
+
+var _ = Describe("Qase", func() {
+	var fake *fakeQase
+
+	BeforeEach(func() {
+		fake = newFakeQase()
+		DeferCleanup(fake.server.Close)
+	})
+
+	newReporter := func(runID int64) *qase.Reporter {
+		return qase.NewReporter(qase.Config{
+			Mode:     "testops",
+			Token:    "secret",
+			Project:  "RT",
+			APIURL:   fake.server.URL + "/v1",
+			RunID:    runID,
+			RunTitle: "Go suite",
+		})
+	}
+
+	It("reads the case IDs from the qase labels", func() {
+		s := spec("installs", types.SpecStatePassed, []string{"qase:12", "k3s", "qase:13", "qase:x"})
+		s.ContainerHierarchyLabels = [][]string{{"install", "qase:11"}}
+		Expect(qase.CaseIDs(s)).To(Equal([]int64{11, 12, 13}))
+	})
+
+	It("fails the step running when the spec failed", func() {
+		s := spec("installs", types.SpecStateFailed, nil,
+			byStep("Installing K3s", 1, 2),
+			byStep("Installing Rancher", 3, 0),
+			byStep("Waiting for Rancher", 4, 0),
+			byStep("Cleaning up", 6, 7),
+		)
+		s.Failure = types.Failure{Message: "timed out", TimelineLocation: types.TimelineLocation{Order: 5}}
+
+		Expect(qase.Steps(s)).To(Equal([]qase.Step{
+			{Position: 1, Status: qase.StatusPassed, Action: "Installing K3s", Comment: "Done in 1s"},
+			{Position: 2, Status: qase.StatusFailed, Action: "Installing Rancher", Comment: "timed out"},
+			{Position: 3, Status: qase.StatusFailed, Action: "Waiting for Rancher", Comment: "timed out"},
+		}))
+	})
+
+	It("creates a run and uploads the results with steps and logs", func() {
+		failed := spec("upgrades", types.SpecStateFailed, []string{"qase:21", "qase:22"}, byStep("Upgrading Rancher", 1, 0))
+		failed.CapturedGinkgoWriterOutput = "helm upgrade rancher\n"
+		failed.Failure = types.Failure{Message: "rancher not ready", TimelineLocation: types.TimelineLocation{Order: 2}}
+		report := types.Report{SpecReports: types.SpecReports{
+			spec("installs", types.SpecStatePassed, []string{"qase:20"}, byStep("Installing K3s", 1, 2)),
+			failed,
+			spec("not mapped", types.SpecStatePassed, nil),
+			spec("filtered out", types.SpecStateSkipped, []string{"qase:23"}),
+			spec("pending", types.SpecStatePending, []string{"qase:24"}),
+		}}
+
+		runFile := filepath.Join(GinkgoT().TempDir(), "QASE_TESTOPS_RUN_ID.txt")
+		r := newReporter(0)
+		r.Config.RunIDFile = runFile
+		runID, count, err := r.Report(report)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(count).To(Equal(4))
+		Expect(fake.runs).To(HaveKeyWithValue(runID, "Go suite"))
+		Expect(os.ReadFile(runFile)).To(BeEquivalentTo(fmt.Sprint(runID)))
+		Expect(fake.tokens).To(HaveEach("secret"))
+
+		results := fake.results[runID]
+		Expect(results).To(HaveLen(4))
+		Expect(results[0]).To(And(
+			HaveField("CaseID", BeEquivalentTo(20)),
+			HaveField("Status", qase.StatusPassed),
+			HaveField("TimeMs", BeEquivalentTo(90000)),
+			HaveField("Attachments", BeEmpty()),
+			HaveField("Steps", ConsistOf(HaveField("Status", qase.StatusPassed))),
+		))
+		for i, id := range []int64{21, 22} {
+			Expect(results[i+1]).To(And(
+				HaveField("CaseID", id),
+				HaveField("Status", qase.StatusFailed),
+				HaveField("Comment", ContainSubstring("rancher not ready")),
+				HaveField("Attachments", Equal([]string{"hash-1"})),
+				HaveField("Steps", ConsistOf(HaveField("Status", qase.StatusFailed))),
+			))
+		}
+		Expect(results[3]).To(And(
+			HaveField("CaseID", BeZero()),
+			HaveField("Case", Equal(&qase.Case{Title: "not mapped", SuiteTitle: "E2E - Install"})),
+			HaveField("Status", qase.StatusPassed),
+		))
+		Expect(fake.attachments).To(HaveKeyWithValue("hash-1", And(
+			HavePrefix("E2E_-_Install_upgrades.log:helm upgrade rancher"),
+			ContainSubstring("rancher not ready"),
+		)))
+		Expect(fake.completed).To(BeEmpty())
+	})
+
+	It("joins an existing run and completes it when asked", func() {
+		r := newReporter(7)
+		r.Config.Complete = true
+		runID, count, err := r.Report(types.Report{SpecReports: types.SpecReports{
+			spec("installs", types.SpecStatePassed, []string{"qase:20"}),
+		}})
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(runID).To(BeEquivalentTo(7))
+		Expect(count).To(Equal(1))
+		Expect(fake.runs).To(HaveLen(1))
+		Expect(fake.results[7]).To(ConsistOf(HaveField("CaseID", BeEquivalentTo(20))))
+		Expect(fake.completed).To(Equal([]int64{7}))
+	})
+
+	It("fails when the run to join does not exist", func() {
+		_, _, err := newReporter(8).Report(types.Report{SpecReports: types.SpecReports{
+			spec("installs", types.SpecStatePassed, []string{"qase:20"}),
+		}})
+		Expect(err).To(MatchError(ContainSubstring("Run not found")))
+		Expect(fake.results).To(BeEmpty())
+	})
+
+	It("does not create a run when no spec was run", func() {
+		runID, count, err := newReporter(0).Report(types.Report{SpecReports: types.SpecReports{
+			spec("filtered out", types.SpecStateSkipped, nil),
+		}})
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(runID).To(BeZero())
+		Expect(count).To(BeZero())
+		Expect(fake.runs).To(HaveLen(1))
+	})
+
+	It("reads the configuration from the environment", func() {
+		GinkgoT().Setenv("QASE_MODE", "off")
+		GinkgoT().Setenv("QASE_API_TOKEN", "")
+		config, err := qase.ConfigFromEnv()
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(config.Enabled()).To(BeFalse())
+
+		GinkgoT().Setenv("QASE_MODE", "testops")
+		_, err = qase.ConfigFromEnv()
+		Expect(err).To(MatchError(ContainSubstring("QASE_API_TOKEN")))
+
+		GinkgoT().Setenv("QASE_API_TOKEN", "secret")
+		GinkgoT().Setenv("QASE_PROJECT_CODE", "RT")
+		GinkgoT().Setenv("QASE_TESTOPS_RUN_ID", "42")
+		config, err = qase.ConfigFromEnv()
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(config.RunID).To(BeEquivalentTo(42))
+
+		GinkgoT().Setenv("QASE_TESTOPS_RUN_ID", "run-42")
+		_, err = qase.ConfigFromEnv()
+		Expect(err).To(HaveOccurred())
+	})
+})
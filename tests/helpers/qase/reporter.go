@@ -0,0 +1,277 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package qase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2/types"
+)
+
+// LabelPrefix is the prefix of the labels holding the Qase case IDs of a spec, e.g. Label("qase:42")
+const LabelPrefix = "qase:"
+
+// Config is the Qase configuration, shared with the Cypress reporter
+type Config struct {
+	Mode           string // QASE_MODE, only "testops" reports
+	Token          string // QASE_API_TOKEN
+	Project        string // QASE_PROJECT_CODE
+	APIURL         string // QASE_API_URL, DefaultAPIURL when empty
+	RunID          int64  // QASE_TESTOPS_RUN_ID, run to join, a new run is created when 0
+	RunTitle       string // QASE_TESTOPS_RUN_TITLE
+	RunDescription string // QASE_TESTOPS_RUN_DESCRIPTION
+	RunIDFile      string // QASE_TESTOPS_RUN_ID_FILE, where to write the ID of the run
+	Complete       bool   // QASE_TESTOPS_RUN_COMPLETE, complete the run once reported
+}
+
+// ConfigFromEnv reads the configuration from the environment
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Mode:           os.Getenv("QASE_MODE"),
+		Token:          os.Getenv("QASE_API_TOKEN"),
+		Project:        os.Getenv("QASE_PROJECT_CODE"),
+		APIURL:         os.Getenv("QASE_API_URL"),
+		RunTitle:       os.Getenv("QASE_TESTOPS_RUN_TITLE"),
+		RunDescription: os.Getenv("QASE_TESTOPS_RUN_DESCRIPTION"),
+		RunIDFile:      os.Getenv("QASE_TESTOPS_RUN_ID_FILE"),
+		Complete:       os.Getenv("QASE_TESTOPS_RUN_COMPLETE") == "true",
+	}
+	if id := os.Getenv("QASE_TESTOPS_RUN_ID"); id != "" {
+		var err error
+		if config.RunID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			return config, fmt.Errorf("invalid QASE_TESTOPS_RUN_ID %q: %w", id, err)
+		}
+	}
+	if !config.Enabled() {
+		return config, nil
+	}
+	if config.Token == "" || config.Project == "" {
+		return config, errors.New("QASE_API_TOKEN and QASE_PROJECT_CODE must be set when QASE_MODE is testops")
+	}
+	if config.RunID == 0 && config.RunTitle == "" {
+		config.RunTitle = "Turtles End-To-End Test Suite"
+	}
+	return config, nil
+}
+
+// Enabled tells if results are reported
+func (c Config) Enabled() bool {
+	return c.Mode == "testops"
+}
+
+// CaseIDs returns the Qase case IDs of a spec, from its labels
+func CaseIDs(spec types.SpecReport) []int64 {
+	var ids []int64
+	for _, label := range spec.Labels() {
+		value, found := strings.CutPrefix(label, LabelPrefix)
+		if !found {
+			continue
+		}
+		if id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// status returns the Qase status of a spec, empty when the spec was not run
+func status(spec types.SpecReport) string {
+	switch {
+	case spec.State == types.SpecStatePassed:
+		return StatusPassed
+	case spec.State.Is(types.SpecStateFailureStates):
+		return StatusFailed
+	case spec.State == types.SpecStateSkipped && spec.Failure.Message != "":
+		// Skipped by Skip(), specs left out by the label filter are not reported
+		return StatusSkipped
+	}
+	return ""
+}
+
+/**
+ * Convert the By steps of a spec to Qase steps, the steps running when the spec failed are failed
+ * @param spec Spec report
+ * @returns Steps in execution order
+ */
+func Steps(spec types.SpecReport) []Step {
+	failed := spec.State.Is(types.SpecStateFailureStates)
+	failureOrder := spec.Failure.TimelineLocation.Order
+
+	var (
+		steps []Step
+		open  []int // index of the steps started and not ended yet
+	)
+	for _, event := range spec.SpecEvents {
+		switch event.SpecEventType {
+		case types.SpecEventByStart:
+			if failed && event.TimelineLocation.Order > failureOrder {
+				// e.g. By in a DeferCleanup, after the failure
+				continue
+			}
+			steps = append(steps, Step{
+				Position: len(steps) + 1,
+				Status:   StatusPassed,
+				Action:   event.Message,
+			})
+			open = append(open, len(steps)-1)
+		case types.SpecEventByEnd:
+			if len(open) == 0 || (failed && event.TimelineLocation.Order > failureOrder) {
+				continue
+			}
+			steps[open[len(open)-1]].Comment = fmt.Sprintf("Done in %s", event.Duration.Round(1e6))
+			open = open[:len(open)-1]
+		}
+	}
+	if failed {
+		// Steps still open at the failure, the By without callback are only ended by the spec
+		for _, i := range open {
+			steps[i].Status = StatusFailed
+			steps[i].Comment = spec.Failure.Message
+		}
+	}
+	return steps
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// logName returns the attachment name of the log of a spec
+func logName(spec types.SpecReport) string {
+	return strings.Trim(unsafeChars.ReplaceAllString(spec.FullText(), "_"), "_") + ".log"
+}
+
+// specLog returns the output of a spec and its failure, empty when there is nothing to attach
+func specLog(spec types.SpecReport) string {
+	log := spec.CombinedOutput()
+	if spec.State.Is(types.SpecStateFailureStates) {
+		log += fmt.Sprintf("\n[%s] %s\n%s\n", spec.State, spec.Failure.Location, spec.Failure.Message)
+	}
+	if strings.TrimSpace(log) == "" {
+		return ""
+	}
+	return log
+}
+
+// Reporter reports a Ginkgo suite to a Qase run
+type Reporter struct {
+	Config Config
+	Client *Client
+}
+
+// NewReporter creates a reporter from a configuration
+func NewReporter(config Config) *Reporter {
+	return &Reporter{
+		Config: config,
+		Client: NewClient(config.APIURL, config.Token, config.Project),
+	}
+}
+
+/**
+ * Convert a spec to one result per Qase case ID, uploading its log as attachment
+ * @param spec Spec report
+ * @returns Results, one by title when the spec has no case ID, none when the spec was not run
+ */
+func (r *Reporter) results(spec types.SpecReport) ([]Result, error) {
+	st := status(spec)
+	if st == "" {
+		return nil, nil
+	}
+
+	var attachments []string
+	if log := specLog(spec); log != "" {
+		hash, err := r.Client.UploadAttachment(logName(spec), []byte(log))
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, hash)
+	}
+
+	comment := spec.FullText()
+	var stacktrace string
+	if spec.Failure.Message != "" {
+		comment += "\n\n" + spec.Failure.Message
+		stacktrace = spec.Failure.Location.FullStackTrace
+	}
+	result := Result{
+		Status:      st,
+		TimeMs:      spec.RunTime.Milliseconds(),
+		Comment:     comment,
+		Stacktrace:  stacktrace,
+		Attachments: attachments,
+		Steps:       Steps(spec),
+	}
+
+	ids := CaseIDs(spec)
+	if len(ids) == 0 {
+		// Like the Cypress reporter, unmapped specs are reported by title
+		result.Case = &Case{Title: spec.LeafNodeText, SuiteTitle: strings.Join(spec.ContainerHierarchyTexts, "\t")}
+		return []Result{result}, nil
+	}
+	results := make([]Result, 0, len(ids))
+	for _, id := range ids {
+		result.CaseID = id
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+/**
+ * Report the specs run to the run of the configuration, or to a new run
+ * @param report Report of the suite, as received by ReportAfterSuite
+ * @returns ID of the run (0 when nothing was reported) and the number of results
+ */
+func (r *Reporter) Report(report types.Report) (int64, int, error) {
+	var results []Result
+	var errs []error
+	for _, spec := range report.SpecReports {
+		if spec.LeafNodeType != types.NodeTypeIt {
+			continue
+		}
+		specResults, err := r.results(spec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", spec.FullText(), err))
+			continue
+		}
+		results = append(results, specResults...)
+	}
+	if len(results) == 0 {
+		return 0, 0, errors.Join(errs...)
+	}
+
+	runID := r.Config.RunID
+	if runID == 0 {
+		var err error
+		if runID, err = r.Client.CreateRun(r.Config.RunTitle, r.Config.RunDescription); err != nil {
+			return 0, 0, errors.Join(append(errs, err)...)
+		}
+	} else if err := r.Client.GetRun(runID); err != nil {
+		return 0, 0, errors.Join(append(errs, fmt.Errorf("run %d: %w", runID, err))...)
+	}
+
+	if r.Config.RunIDFile != "" {
+		errs = append(errs, os.WriteFile(r.Config.RunIDFile, []byte(strconv.FormatInt(runID, 10)), 0o644))
+	}
+	if err := r.Client.CreateResults(runID, results); err != nil {
+		return runID, 0, errors.Join(append(errs, err)...)
+	}
+	if r.Config.Complete {
+		errs = append(errs, r.Client.CompleteRun(runID))
+	}
+	return runID, len(results), errors.Join(errs...)
+}
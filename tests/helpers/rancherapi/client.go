@@ -0,0 +1,246 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rancherapi is a minimal client of the Rancher v3 API, enough to prepare a freshly
+// installed Rancher headlessly: first login, API tokens and cloud credentials.
+package rancherapi
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultUser is the admin user created by Rancher
+	DefaultUser = "admin"
+	// DefaultBootstrapPassword is the bootstrap password set by ele-testhelpers when installing Rancher
+	DefaultBootstrapPassword = "rancherpassword"
+)
+
+// Client talks to the Rancher API, create it with New
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// APIError is returned when Rancher answers with a non-2xx status
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: HTTP %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+// IsUnauthorized tells if the error is a rejected authentication
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// New creates a client for the Rancher server at url (e.g. https://rancher.example.com).
+// When insecure is true the server certificate is not verified, as with the default self-signed one.
+func New(url string, insecure bool) *Client {
+	if !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(url, "/"),
+		http: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}, // #nosec G402 -- opt-in for self-signed test certificates
+			},
+		},
+	}
+}
+
+// WithToken returns a copy of the client authenticated with an existing API token
+func (c *Client) WithToken(token string) *Client {
+	clone := *c
+	clone.token = token
+	return &clone
+}
+
+// Token returns the API token of the client, empty before Login
+func (c *Client) Token() string {
+	return c.token
+}
+
+// do sends a request to the API and decodes the JSON answer into out, if not nil
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Login logs in as a local user and keeps the session token for the next calls
+func (c *Client) Login(user, password string) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	err := c.do(http.MethodPost, "/v3-public/localProviders/local?action=login", map[string]string{
+		"username":     user,
+		"password":     password,
+		"responseType": "token",
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Token == "" {
+		return errors.New("login succeeded but no token was returned")
+	}
+	c.token = resp.Token
+	return nil
+}
+
+// ChangePassword changes the password of the logged in user
+func (c *Client) ChangePassword(current, password string) error {
+	return c.do(http.MethodPost, "/v3/users?action=changepassword", map[string]string{
+		"currentPassword": current,
+		"newPassword":     password,
+	}, nil)
+}
+
+// SetSetting sets a Rancher setting, e.g. server-url
+func (c *Client) SetSetting(name, value string) error {
+	return c.do(http.MethodPut, "/v3/settings/"+name, map[string]string{"value": value}, nil)
+}
+
+// GetSetting returns the value of a Rancher setting
+func (c *Client) GetSetting(name string) (string, error) {
+	var setting struct {
+		Value string `json:"value"`
+	}
+	if err := c.do(http.MethodGet, "/v3/settings/"+name, nil, &setting); err != nil {
+		return "", err
+	}
+	return setting.Value, nil
+}
+
+// Bootstrap does what the first login in the UI does: replace the bootstrap password, set the
+// server URL and accept the terms. It is idempotent, on a bootstrapped Rancher it logs in with password.
+// Only DefaultUser has a bootstrap password, any other user is rejected.
+func (c *Client) Bootstrap(user, bootstrapPassword, password, serverURL string) error {
+	if user != DefaultUser {
+		return fmt.Errorf("only the %s user can bootstrap Rancher, not %s", DefaultUser, user)
+	}
+
+	err := c.Login(user, bootstrapPassword)
+	switch {
+	case IsUnauthorized(err) && bootstrapPassword != password:
+		// Password already changed
+		if err := c.Login(user, password); err != nil {
+			return fmt.Errorf("logging in: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("logging in with the bootstrap password: %w", err)
+	case bootstrapPassword != password:
+		if err := c.ChangePassword(bootstrapPassword, password); err != nil {
+			return fmt.Errorf("changing the %s password: %w", user, err)
+		}
+	}
+
+	settings := [][2]string{
+		{"server-url", serverURL},
+		{"eula-agreed", time.Now().UTC().Format(time.RFC3339)},
+		{"first-login", "false"},
+	}
+	for _, s := range settings {
+		if s[1] == "" {
+			continue
+		}
+		if err := c.SetSetting(s[0], s[1]); err != nil {
+			return fmt.Errorf("setting %s: %w", s[0], err)
+		}
+	}
+	return nil
+}
+
+// Token is a Rancher API token
+type Token struct {
+	ID          string `json:"id,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	ClusterID   string `json:"clusterId,omitempty"` // scopes the token to a cluster
+	TTL         int64  `json:"ttl,omitempty"`       // milliseconds, 0 for the server default
+	Token       string `json:"token,omitempty"`     // bearer token, only returned on creation
+}
+
+// CreateToken creates an API token, scoped to clusterID when not empty
+func (c *Client) CreateToken(description, clusterID string, ttl time.Duration) (*Token, error) {
+	token := &Token{
+		Type:        "token",
+		Description: description,
+		ClusterID:   clusterID,
+		TTL:         ttl.Milliseconds(),
+	}
+	created := &Token{}
+	if err := c.do(http.MethodPost, "/v3/tokens", token, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// DeleteToken deletes an API token by ID
+func (c *Client) DeleteToken(id string) error {
+	return c.do(http.MethodDelete, "/v3/tokens/"+id, nil, nil)
+}
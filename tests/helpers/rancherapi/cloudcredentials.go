@@ -0,0 +1,103 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rancherapi
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CloudCredentialNamespace is where Rancher stores the cloud credential secrets
+const CloudCredentialNamespace = "cattle-global-data"
+
+// AWSCredentialConfig is the amazonec2 cloud credential
+type AWSCredentialConfig struct {
+	AccessKey     string `json:"accessKey"`
+	SecretKey     string `json:"secretKey"`
+	DefaultRegion string `json:"defaultRegion,omitempty"`
+}
+
+// AzureCredentialConfig is the azure cloud credential
+type AzureCredentialConfig struct {
+	ClientID       string `json:"clientId"`
+	ClientSecret   string `json:"clientSecret"`
+	SubscriptionID string `json:"subscriptionId"`
+	TenantID       string `json:"tenantId,omitempty"`
+	Environment    string `json:"environment,omitempty"`
+}
+
+// GCPCredentialConfig is the google cloud credential
+type GCPCredentialConfig struct {
+	AuthEncodedJSON string `json:"authEncodedJson"` // service account key JSON
+}
+
+// VSphereCredentialConfig is the vmwarevsphere cloud credential
+type VSphereCredentialConfig struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	VCenter     string `json:"vcenter"`
+	VCenterPort string `json:"vcenterPort,omitempty"`
+}
+
+// CloudCredential is a Rancher cloud credential, set exactly one of the configs
+type CloudCredential struct {
+	ID      string                   `json:"id,omitempty"` // <namespace>:<secret name>
+	Type    string                   `json:"type,omitempty"`
+	Name    string                   `json:"name"`
+	AWS     *AWSCredentialConfig     `json:"amazonec2credentialConfig,omitempty"`
+	Azure   *AzureCredentialConfig   `json:"azurecredentialConfig,omitempty"`
+	GCP     *GCPCredentialConfig     `json:"googlecredentialConfig,omitempty"`
+	VSphere *VSphereCredentialConfig `json:"vmwarevspherecredentialConfig,omitempty"`
+}
+
+// SecretName returns the name of the secret backing the credential in CloudCredentialNamespace
+func (c *CloudCredential) SecretName() string {
+	if _, name, found := strings.Cut(c.ID, ":"); found {
+		return name
+	}
+	return c.ID
+}
+
+// CreateCloudCredential creates a cloud credential
+func (c *Client) CreateCloudCredential(cred CloudCredential) (*CloudCredential, error) {
+	cred.Type = "cloudCredential"
+	created := &CloudCredential{}
+	if err := c.do(http.MethodPost, "/v3/cloudcredentials", cred, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// FindCloudCredential returns the cloud credential with the given name, nil if not found
+func (c *Client) FindCloudCredential(name string) (*CloudCredential, error) {
+	var list struct {
+		Data []CloudCredential `json:"data"`
+	}
+	if err := c.do(http.MethodGet, "/v3/cloudcredentials?name="+url.QueryEscape(name), nil, &list); err != nil {
+		return nil, err
+	}
+	for i := range list.Data {
+		if list.Data[i].Name == name {
+			return &list.Data[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// DeleteCloudCredential deletes a cloud credential by ID
+func (c *Client) DeleteCloudCredential(id string) error {
+	return c.do(http.MethodDelete, "/v3/cloudcredentials/"+id, nil, nil)
+}
@@ -0,0 +1,226 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rancherapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher/rancher-turtles-e2e/tests/helpers/rancherapi"
+)
+
+// fakeRancher is a Rancher v3 API server with a single admin user, recording the settings and tokens it receives
+type fakeRancher struct {
+	sync.Mutex
+	server      *httptest.Server
+	password    string
+	sessions    map[string]bool // session and API tokens accepted
+	settings    map[string]string
+	tokens      map[string]rancherapi.Token // by ID
+	credentials []rancherapi.CloudCredential
+	logins      []string // user:password of the login attempts
+}
+
+func newFakeRancher(password string) *fakeRancher {
+	f := &fakeRancher{
+		password: password,
+		sessions: map[string]bool{},
+		settings: map[string]string{"server-version": "v2.14.1"},
+		tokens:   map[string]rancherapi.Token{},
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeRancher) reply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeRancher) serve(w http.ResponseWriter, r *http.Request) {
+	// The handler runs in the server goroutine, a failed assertion must fail the spec
+	defer GinkgoRecover()
+	f.Lock()
+	defer f.Unlock()
+
+	if r.URL.Path == "/v3-public/localProviders/local" && r.URL.Query().Get("action") == "login" {
+		var login map[string]string
+		Expect(json.NewDecoder(r.Body).Decode(&login)).To(Succeed())
+		f.logins = append(f.logins, login["username"]+":"+login["password"])
+		if login["username"] != rancherapi.DefaultUser || login["password"] != f.password {
+			f.reply(w, http.StatusUnauthorized, map[string]string{"message": "authentication failed"})
+			return
+		}
+		session := "session-" + time.Now().Format("150405.000000000")
+		f.sessions[session] = true
+		f.reply(w, http.StatusCreated, map[string]string{"token": session})
+		return
+	}
+
+	if !f.sessions[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+		f.reply(w, http.StatusUnauthorized, map[string]string{"message": "must authenticate"})
+		return
+	}
+
+	switch path := r.URL.Path; {
+	case r.Method == http.MethodPost && path == "/v3/users" && r.URL.Query().Get("action") == "changepassword":
+		var change map[string]string
+		Expect(json.NewDecoder(r.Body).Decode(&change)).To(Succeed())
+		if change["currentPassword"] != f.password {
+			f.reply(w, http.StatusUnprocessableEntity, map[string]string{"message": "invalid current password"})
+			return
+		}
+		f.password = change["newPassword"]
+		f.reply(w, http.StatusOK, nil)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/v3/settings/"):
+		var setting map[string]string
+		Expect(json.NewDecoder(r.Body).Decode(&setting)).To(Succeed())
+		f.settings[strings.TrimPrefix(path, "/v3/settings/")] = setting["value"]
+		f.reply(w, http.StatusOK, setting)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/v3/settings/"):
+		value, found := f.settings[strings.TrimPrefix(path, "/v3/settings/")]
+		if !found {
+			f.reply(w, http.StatusNotFound, map[string]string{"message": "not found"})
+			return
+		}
+		f.reply(w, http.StatusOK, map[string]string{"value": value})
+	case r.Method == http.MethodPost && path == "/v3/tokens":
+		var token rancherapi.Token
+		Expect(json.NewDecoder(r.Body).Decode(&token)).To(Succeed())
+		token.ID = "token-" + string(rune('a'+len(f.tokens)))
+		token.Token = token.ID + ":secret"
+		f.tokens[token.ID] = token
+		f.sessions[token.Token] = true
+		f.reply(w, http.StatusCreated, token)
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/v3/tokens/"):
+		id := strings.TrimPrefix(path, "/v3/tokens/")
+		delete(f.sessions, f.tokens[id].Token)
+		delete(f.tokens, id)
+		f.reply(w, http.StatusNoContent, nil)
+	case r.Method == http.MethodPost && path == "/v3/cloudcredentials":
+		var cred rancherapi.CloudCredential
+		Expect(json.NewDecoder(r.Body).Decode(&cred)).To(Succeed())
+		cred.ID = rancherapi.CloudCredentialNamespace + ":cc-" + cred.Name
+		f.credentials = append(f.credentials, cred)
+		f.reply(w, http.StatusCreated, cred)
+	case r.Method == http.MethodGet && path == "/v3/cloudcredentials":
+		var data []rancherapi.CloudCredential
+		for _, c := range f.credentials {
+			if c.Name == r.URL.Query().Get("name") {
+				data = append(data, c)
+			}
+		}
+		f.reply(w, http.StatusOK, map[string]any{"data": data})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var _ = Describe("Rancher API client", func() {
+	var (
+		fake   *fakeRancher
+		client *rancherapi.Client
+	)
+
+	BeforeEach(func() {
+		fake = newFakeRancher(rancherapi.DefaultBootstrapPassword)
+		DeferCleanup(fake.server.Close)
+		client = rancherapi.New(fake.server.URL, false)
+	})
+
+	It("replaces the bootstrap password, sets the server URL and accepts the terms", func() {
+		Expect(client.Bootstrap(rancherapi.DefaultUser, rancherapi.DefaultBootstrapPassword, "new-password", "https://rancher.example.com")).To(Succeed())
+		Expect(fake.password).To(Equal("new-password"))
+		Expect(fake.settings).To(HaveKeyWithValue("server-url", "https://rancher.example.com"))
+		Expect(fake.settings).To(HaveKeyWithValue("first-login", "false"))
+		Expect(fake.settings).To(HaveKey("eula-agreed"))
+		Expect(client.Token()).To(Not(BeEmpty()))
+	})
+
+	It("logs in with the password on a bootstrapped Rancher", func() {
+		fake.password = "new-password"
+		Expect(client.Bootstrap(rancherapi.DefaultUser, rancherapi.DefaultBootstrapPassword, "new-password", "")).To(Succeed())
+		Expect(fake.logins).To(Equal([]string{"admin:" + rancherapi.DefaultBootstrapPassword, "admin:new-password"}))
+		Expect(fake.settings).To(Not(HaveKey("server-url")))
+	})
+
+	It("rejects another user than admin", func() {
+		err := client.Bootstrap("turtles", rancherapi.DefaultBootstrapPassword, "new-password", "")
+		Expect(err).To(MatchError(ContainSubstring("only the admin user")))
+		Expect(fake.logins).To(BeEmpty())
+		Expect(fake.password).To(Equal(rancherapi.DefaultBootstrapPassword))
+	})
+
+	It("reports a rejected login as unauthorized", func() {
+		err := client.Login(rancherapi.DefaultUser, "wrong")
+		Expect(rancherapi.IsUnauthorized(err)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("HTTP 401")))
+
+		_, err = client.GetSetting("server-version")
+		Expect(rancherapi.IsUnauthorized(err)).To(BeTrue())
+	})
+
+	It("creates API tokens, scoped to a cluster when asked", func() {
+		Expect(client.Login(rancherapi.DefaultUser, rancherapi.DefaultBootstrapPassword)).To(Succeed())
+
+		token, err := client.CreateToken("turtles-e2e", "", 0)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(fake.tokens[token.ID].ClusterID).To(BeEmpty())
+		Expect(fake.tokens[token.ID].TTL).To(BeZero())
+
+		scoped, err := client.CreateToken("turtles-e2e-local", "local", time.Hour)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(scoped.ClusterID).To(Equal("local"))
+		Expect(fake.tokens[scoped.ID].ClusterID).To(Equal("local"))
+		Expect(fake.tokens[scoped.ID].TTL).To(Equal(int64(3600000)))
+		Expect(fake.tokens[scoped.ID].Type).To(Equal("token"))
+
+		// The tokens authenticate the next calls, until deleted
+		withToken := client.WithToken(scoped.Token)
+		Expect(withToken.GetSetting("server-version")).To(Equal("v2.14.1"))
+		Expect(client.DeleteToken(scoped.ID)).To(Succeed())
+		_, err = withToken.GetSetting("server-version")
+		Expect(rancherapi.IsUnauthorized(err)).To(BeTrue())
+	})
+
+	It("creates and finds cloud credentials", func() {
+		Expect(client.Login(rancherapi.DefaultUser, rancherapi.DefaultBootstrapPassword)).To(Succeed())
+
+		found, err := client.FindCloudCredential("aws")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(found).To(BeNil())
+
+		created, err := client.CreateCloudCredential(rancherapi.CloudCredential{
+			Name: "aws",
+			AWS:  &rancherapi.AWSCredentialConfig{AccessKey: "key", SecretKey: "secret"},
+		})
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(created.SecretName()).To(Equal("cc-aws"))
+		Expect(fake.credentials).To(HaveLen(1))
+		Expect(fake.credentials[0].Type).To(Equal("cloudCredential"))
+
+		found, err = client.FindCloudCredential("aws")
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(found.ID).To(Equal(rancherapi.CloudCredentialNamespace + ":cc-aws"))
+		Expect(found.AWS.AccessKey).To(Equal("key"))
+	})
+})
@@ -0,0 +1,200 @@
+/*
+Copyright © 2022 - 2026 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registryauth gives access to OCI registries needing credentials (docker config.json
+// or explicit credentials per host) or reached over plain HTTP, like staging registries and local mirrors.
+package registryauth
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+var (
+	// ErrUnauthorized is returned when the registry rejects the credentials, or needs some
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is returned when the repository or tag does not exist
+	ErrNotFound = errors.New("not found")
+)
+
+// dockerHubAliases are the host names docker config.json may use for Docker Hub
+var dockerHubAliases = []string{"docker.io", "index.docker.io", "registry-1.docker.io", "https://index.docker.io/v1/"}
+
+// Registries holds the credentials and transport settings of the registries
+type Registries struct {
+	credentials map[string]authn.AuthConfig
+	insecure    map[string]bool
+}
+
+/**
+ * Create the registry settings
+ * @param dockerConfig Content of a docker config.json, may be empty
+ * @param credentials Explicit credentials by registry host, they take precedence over dockerConfig
+ * @param insecure Hosts reached over plain HTTP or with an untrusted certificate
+ * @returns The registry settings
+ */
+func New(dockerConfig []byte, credentials map[string]authn.AuthConfig, insecure []string) (*Registries, error) {
+	r := &Registries{credentials: map[string]authn.AuthConfig{}, insecure: map[string]bool{}}
+
+	if len(strings.TrimSpace(string(dockerConfig))) > 0 {
+		var config struct {
+			Auths map[string]authn.AuthConfig `json:"auths"`
+		}
+		if err := json.Unmarshal(dockerConfig, &config); err != nil {
+			return nil, fmt.Errorf("parsing docker config: %w", err)
+		}
+		for host, auth := range config.Auths {
+			if auth.Auth != "" && auth.Username == "" {
+				decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+				if err != nil {
+					return nil, fmt.Errorf("decoding docker config auth of %s: %w", host, err)
+				}
+				auth.Username, auth.Password, _ = strings.Cut(string(decoded), ":")
+				auth.Auth = ""
+			}
+			r.credentials[normalizeHost(host)] = auth
+		}
+	}
+	for host, auth := range credentials {
+		r.credentials[normalizeHost(host)] = auth
+	}
+	for _, host := range insecure {
+		r.insecure[normalizeHost(host)] = true
+	}
+	return r, nil
+}
+
+/**
+ * Create the registry settings from the environment
+ * DOCKER_REGISTRY_CONFIG: content of a docker config.json
+ * REGISTRY_CREDENTIALS: space separated host=username:token entries
+ * INSECURE_REGISTRIES: space or comma separated hosts reached over plain HTTP
+ * @returns The registry settings
+ */
+func FromEnv() (*Registries, error) {
+	credentials := map[string]authn.AuthConfig{}
+	for _, entry := range strings.Fields(os.Getenv("REGISTRY_CREDENTIALS")) {
+		host, userToken, found := strings.Cut(entry, "=")
+		user, token, hasToken := strings.Cut(userToken, ":")
+		if !found || !hasToken || host == "" {
+			return nil, fmt.Errorf("invalid REGISTRY_CREDENTIALS entry for %q, expected host=username:token", host)
+		}
+		credentials[host] = authn.AuthConfig{Username: user, Password: token}
+	}
+	insecure := strings.Fields(strings.ReplaceAll(os.Getenv("INSECURE_REGISTRIES"), ",", " "))
+	return New([]byte(os.Getenv("DOCKER_REGISTRY_CONFIG")), credentials, insecure)
+}
+
+// normalizeHost strips the scheme and path of a docker config.json entry and maps Docker Hub aliases to docker.io
+func normalizeHost(host string) string {
+	for _, alias := range dockerHubAliases {
+		if host == alias {
+			return name.DefaultRegistry
+		}
+	}
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	return host
+}
+
+// Resolve implements authn.Keychain, registries without credentials are accessed anonymously
+func (r *Registries) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	host := resource.RegistryStr()
+	if host == "index.docker.io" {
+		host = name.DefaultRegistry
+	}
+	if auth, found := r.credentials[host]; found {
+		return authn.FromConfig(auth), nil
+	}
+	return authn.Anonymous, nil
+}
+
+// HasCredentials tells if credentials are set for a registry host
+func (r *Registries) HasCredentials(host string) bool {
+	_, found := r.credentials[normalizeHost(host)]
+	return found
+}
+
+// Insecure tells if a registry host is reached over plain HTTP
+func (r *Registries) Insecure(host string) bool {
+	return r.insecure[normalizeHost(host)]
+}
+
+// CraneOptions returns the crane options to access a registry host
+func (r *Registries) CraneOptions(host string) []crane.Option {
+	opts := []crane.Option{crane.WithAuthFromKeychain(r)}
+	if r.Insecure(host) {
+		opts = append(opts, crane.Insecure)
+	}
+	return opts
+}
+
+// RemoteOptions returns the remote options to access a registry host, references must be parsed with NameOptions
+func (r *Registries) RemoteOptions(host string) []remote.Option {
+	opts := []remote.Option{remote.WithAuthFromKeychain(r)}
+	if r.Insecure(host) {
+		t := remote.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- opt-in for local mirrors
+		opts = append(opts, remote.WithTransport(t))
+	}
+	return opts
+}
+
+// NameOptions returns the options to parse references of a registry host
+func (r *Registries) NameOptions(host string) []name.Option {
+	if r.Insecure(host) {
+		return []name.Option{name.Insecure}
+	}
+	return nil
+}
+
+/**
+ * Classify a registry error, so that a credential problem is not reported as a missing artifact
+ * @param err Error returned by a registry operation
+ * @returns err wrapped with ErrUnauthorized or ErrNotFound when recognized, err otherwise
+ */
+func Classify(err error) error {
+	var terr *transport.Error
+	if err == nil || !errors.As(err, &terr) {
+		return err
+	}
+
+	for _, d := range terr.Errors {
+		switch d.Code {
+		case transport.UnauthorizedErrorCode, transport.DeniedErrorCode:
+			return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+		case transport.ManifestUnknownErrorCode, transport.NameUnknownErrorCode, transport.BlobUnknownErrorCode:
+			return fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+	}
+	switch terr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
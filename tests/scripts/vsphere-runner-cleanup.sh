@@ -3,6 +3,10 @@
 # do not exit on failure
 set +e
 
+# uninstall the chart server
+sudo systemctl disable --now turtles-chart-server
+sudo rm /etc/systemd/system/turtles-chart-server.service
+sudo rm -r /var/lib/turtles-chart-server /tmp/system-charts
 # uninstall chartmuseum
 sudo systemctl stop chartmuseum
 sudo rm /etc/systemd/system/chartmuseum.service